@@ -2,11 +2,10 @@ package nebel
 
 import (
 	"github.com/alecthomas/chroma/v2"
-	"github.com/alecthomas/chroma/v2/lexers"
 )
 
 func init() {
-	lexers.Register(chroma.MustNewLexer(
+	registerCustomLexer(chroma.MustNewLexer(
 		&chroma.Config{
 			Name:      "Carina",
 			Aliases:   []string{"carina", "crn"},
@@ -18,35 +17,41 @@ func init() {
 				"root": {
 					// Comments
 					{Pattern: `#.*$`, Type: chroma.Comment, Mutator: nil},
+					{Pattern: `//.*$`, Type: chroma.Comment, Mutator: nil},
 
 					// Keywords (storage, declaration, control, other) — see carina-core keywords.rs
 					{Pattern: `\b(fn|let|arguments|attributes|backend|exports|moved|provider|removed|upstream_state|validation|else|for|if|in|import|read|require|use)\b`, Type: chroma.Keyword, Mutator: nil},
 
-					// Null literal
-					{Pattern: `\bnull\b`, Type: chroma.KeywordConstant, Mutator: nil},
-
 					// Built-in types/functions
 					{Pattern: `\b(ref|list|bool|cidr|string|number)\b`, Type: chroma.KeywordType, Mutator: nil},
 
 					// Booleans
 					{Pattern: `\b(true|false)\b`, Type: chroma.KeywordConstant, Mutator: nil},
 
+					// Region constants (aws.Region.xxx, gcp.Region.xxx, ...)
+					{Pattern: `[a-z][a-z0-9_]*\.Region\.[a-z][a-z0-9_]*`, Type: chroma.NameConstant, Mutator: nil},
+
 					// Resource types (aws.s3.bucket, awscc.ec2.SecurityGroup, etc.)
 					// Last segment can be PascalCase (new casing) or snake_case (legacy)
 					{Pattern: `(aws|awscc|gcp|azure)\.[a-z][a-zA-Z0-9_]*(\.[a-zA-Z][a-zA-Z0-9_]*)*`, Type: chroma.NameClass, Mutator: nil},
 
-					// Region constants (aws.Region.xxx)
-					{Pattern: `aws\.Region\.[a-z][a-z0-9_]*`, Type: chroma.NameConstant, Mutator: nil},
+					// Resource types of other providers, recognized by the block that follows
+					{Pattern: `[a-z][a-z0-9_]*(\.[a-zA-Z][a-zA-Z0-9_]*)+(?=\s*\{)`, Type: chroma.NameClass, Mutator: nil},
+
+					// Heredoc strings (<<EOT ... EOT, or <<-EOT with an indented terminator)
+					{Pattern: `(<<-?)([A-Za-z_][A-Za-z0-9_]*)(\n)((?:.*\n)*?)([ \t]*)(\2)\b`, Type: chroma.ByGroups(chroma.StringHeredoc, chroma.StringHeredoc, chroma.Text, chroma.UsingSelf("heredoc"), chroma.Text, chroma.StringHeredoc), Mutator: nil},
 
 					// Strings
 					{Pattern: `"`, Type: chroma.StringDouble, Mutator: chroma.Push("string")},
 					{Pattern: `'`, Type: chroma.StringSingle, Mutator: chroma.Push("sstring")},
 
-					// Numbers
-					{Pattern: `\b[0-9]+\b`, Type: chroma.NumberInteger, Mutator: nil},
+					// Numbers (a leading minus is a sign unless it follows an operand)
+					{Pattern: `(?<![\w)\]])-?[0-9]+\.[0-9]+([eE][+-]?[0-9]+)?\b`, Type: chroma.NumberFloat, Mutator: nil},
+					{Pattern: `(?<![\w)\]])-?[0-9]+[eE][+-]?[0-9]+\b`, Type: chroma.NumberFloat, Mutator: nil},
+					{Pattern: `(?<![\w)\]])-?[0-9]+\b`, Type: chroma.NumberInteger, Mutator: nil},
 
 					// Operators
-					{Pattern: `=`, Type: chroma.Operator, Mutator: nil},
+					{Pattern: `==|!=|<=|>=|->|&&|\|\||[=<>!+\-*/%]`, Type: chroma.Operator, Mutator: nil},
 
 					// Punctuation
 					{Pattern: `[{}()\[\],.]`, Type: chroma.Punctuation, Mutator: nil},
@@ -55,21 +60,40 @@ func init() {
 					{Pattern: `[a-zA-Z][a-zA-Z0-9_]*(?=\s*=[^=])`, Type: chroma.NameAttribute, Mutator: nil},
 
 					// Identifiers
-					{Pattern: `[a-zA-Z][a-zA-Z0-9_]*`, Type: chroma.NameVariable, Mutator: nil},
+					{Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`, Type: chroma.NameVariable, Mutator: nil},
 
 					// Whitespace
 					{Pattern: `\s+`, Type: chroma.Text, Mutator: nil},
 				},
 				"string": {
 					{Pattern: `\\.`, Type: chroma.StringEscape, Mutator: nil},
+					{Pattern: `\$\{`, Type: chroma.StringInterpol, Mutator: chroma.Push("interpolation")},
 					{Pattern: `"`, Type: chroma.StringDouble, Mutator: chroma.Pop(1)},
-					{Pattern: `[^"\\]+`, Type: chroma.StringDouble, Mutator: nil},
+					{Pattern: `[^"\\$]+`, Type: chroma.StringDouble, Mutator: nil},
+					{Pattern: `\$`, Type: chroma.StringDouble, Mutator: nil},
 				},
 				"sstring": {
 					{Pattern: `\\.`, Type: chroma.StringEscape, Mutator: nil},
 					{Pattern: `'`, Type: chroma.StringSingle, Mutator: chroma.Pop(1)},
 					{Pattern: `[^'\\]+`, Type: chroma.StringSingle, Mutator: nil},
 				},
+				"heredoc": {
+					{Pattern: `\$\{`, Type: chroma.StringInterpol, Mutator: chroma.Push("interpolation")},
+					{Pattern: `[^$]+`, Type: chroma.StringHeredoc, Mutator: nil},
+					{Pattern: `\$`, Type: chroma.StringHeredoc, Mutator: nil},
+				},
+				// Expressions inside ${...}; a nested { } pair is tracked so
+				// the closing brace of a map literal doesn't end it early
+				"interpolation": {
+					{Pattern: `\}`, Type: chroma.StringInterpol, Mutator: chroma.Pop(1)},
+					{Pattern: `\{`, Type: chroma.Punctuation, Mutator: chroma.Push("interpolation-braces")},
+					chroma.Include("root"),
+				},
+				"interpolation-braces": {
+					{Pattern: `\}`, Type: chroma.Punctuation, Mutator: chroma.Pop(1)},
+					{Pattern: `\{`, Type: chroma.Punctuation, Mutator: chroma.Push("interpolation-braces")},
+					chroma.Include("root"),
+				},
 			}
 		},
 	))
@@ -0,0 +1,78 @@
+package nebel
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testLexerGolden tokenises every file matching pattern with the lexer for
+// lang and compares the tokens with the .golden file next to it. Run the
+// tests with -update to rewrite the golden files.
+func testLexerGolden(t *testing.T, lang, pattern string) {
+	t.Helper()
+
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		t.Fatalf("no lexer for %s", lang)
+	}
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no files match %s", pattern)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got strings.Builder
+			for _, token := range iterator.Tokens() {
+				fmt.Fprintf(&got, "%s %q\n", token.Type, token.Value)
+			}
+
+			golden := strings.TrimSuffix(file, filepath.Ext(file)) + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got.String()), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("tokens differ from %s (run with -update to accept):\n%s", golden, got.String())
+			}
+		})
+	}
+}
+
+// The testdata/carina snippets are written by hand, not copied from
+// carina-core's examples, so they stick to constructs the lexer was
+// written from: blocks, let bindings, strings with ${} interpolation,
+// heredocs, numbers and operators.
+func TestCarinaLexer(t *testing.T) {
+	testLexerGolden(t, "carina", "testdata/carina/*.crn")
+}
@@ -1,32 +1,180 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/alecthomas/kong"
 	"github.com/mizzy/nebel"
 )
 
 var CLI struct {
+	Init struct {
+		Dir   string `arg:"" name:"dir" help:"Directory to create the site in."`
+		Title string `help:"Site title; the directory name when omitted."`
+	} `cmd:"" help:"Create a new site."`
 	New struct {
-		Title string `arg:"" name:"title" help:"Title of the new post." type:"title"`
+		Title string   `arg:"" name:"title" help:"Title of the new post." type:"title"`
+		Slug  string   `help:"File name slug; made from the title when omitted."`
+		Tags  []string `help:"Comma-separated tags."`
+		Draft bool     `help:"Mark the post as a draft, which generate skips."`
+		Date  string   `help:"Date as YYYY-MM-DD or YYYY-MM-DD HH:MM; now when omitted."`
+		Edit  bool     `short:"e" help:"Open the new post in $$EDITOR."`
+		Kind  string   `short:"k" default:"post" help:"Archetype to start from, archetypes/<kind>.md."`
 	} `cmd:"" help:"Create a new post."`
 	Generate struct {
+		Verbose        bool   `short:"v" xor:"verbosity" help:"Print each phase and file written."`
+		Quiet          bool   `short:"q" xor:"verbosity" help:"Print nothing but errors."`
+		Report         string `placeholder:"FILE" help:"Write a JSON build report to FILE, - for stdout."`
+		DryRun         bool   `help:"List stale files in public/ instead of removing them."`
+		FetchLinkCards bool   `help:"Fetch link cards missing from data/linkcards.json."`
 	} `cmd:"" help:"Generate files."`
+	Clean struct {
+		DryRun bool `help:"List what would be removed."`
+	} `cmd:"" help:"Remove the generated files in public/."`
+	List struct {
+		Tag     string `help:"Only posts with this tag."`
+		Since   string `help:"Only posts on or after this date, YYYY-MM-DD."`
+		Drafts  bool   `help:"Include drafts."`
+		Sort    string `default:"date" enum:"date,title,chars,words" help:"Sort by date, title, chars or words."`
+		Reverse bool   `short:"r" help:"Reverse the order."`
+		JSON    bool   `name:"json" help:"Print JSON."`
+	} `cmd:"" help:"List posts and their paths."`
+	Stats struct {
+		JSON bool `name:"json" help:"Print JSON."`
+	} `cmd:"" help:"Show statistics about the posts."`
+	Import struct {
+		File        string `arg:"" name:"file" help:"Export file." type:"existingfile"`
+		From        string `required:"" enum:"mt,wxr" help:"Export format: mt for Movable Type and Hatena Blog, wxr for WordPress."`
+		Images      string `help:"Directory of the images the posts reference." type:"existingdir"`
+		AliasPrefix string `default:"/entry/" help:"Prefix of a Movable Type BASENAME in old URLs."`
+	} `cmd:"" help:"Import posts from another blog."`
+	Export struct {
+		Epub struct {
+			Output         string `short:"o" default:"blog.epub" help:"File to write; - for stdout."`
+			Title          string `help:"Book title; the site name when omitted."`
+			Tag            string `help:"Only posts with this tag."`
+			Since          string `help:"Only posts on or after this date, YYYY-MM-DD."`
+			Until          string `help:"Only posts on or before this date, YYYY-MM-DD."`
+			Language       string `default:"ja" help:"Language of the book."`
+			FetchLinkCards bool   `help:"Fetch link cards missing from data/linkcards.json."`
+		} `cmd:"" name:"epub" help:"Export posts as an EPUB book."`
+	} `cmd:"" help:"Export posts."`
+	Og struct {
+		Post   string `arg:"" optional:"" name:"post" help:"Post file to render." type:"existingfile"`
+		Title  string `help:"Render this title instead of the post's."`
+		Output string `short:"o" help:"File to write; stdout when omitted."`
+		Sheet  bool   `help:"Write an HTML contact sheet of every post's OG image."`
+	} `cmd:"" help:"Preview OG images."`
 }
 
 func main() {
-	ctx := kong.Parse(&CLI)
+	ctx := kong.Parse(&CLI, kong.Exit(func(code int) {
+		// Kong exits with 1 on usage errors, which nebel uses for failures
+		if code == 1 {
+			code = 2
+		}
+		os.Exit(code)
+	}))
+
+	site := nebel.NewSite(".")
 	switch ctx.Command() {
+	case "init <dir>":
+		err := nebel.InitSite(CLI.Init.Dir, nebel.InitOptions{
+			Title: CLI.Init.Title,
+		})
+		if err != nil {
+			fatal(err)
+		}
 	case "new <title>":
-		err := nebel.CreateNewPost(CLI.New.Title)
+		path, err := site.CreateNewPost(CLI.New.Title, nebel.NewPostOptions{
+			Slug:  CLI.New.Slug,
+			Tags:  CLI.New.Tags,
+			Draft: CLI.New.Draft,
+			Date:  CLI.New.Date,
+			Edit:  CLI.New.Edit,
+			Kind:  CLI.New.Kind,
+		})
 		if err != nil {
-			panic(err)
+			fatal(err)
 		}
+		fmt.Println(path)
 	case "generate":
-		err := nebel.Generate()
+		if CLI.Generate.FetchLinkCards {
+			site.LinkCards = nebel.DefaultLinkCardFetcher
+		}
+		_, err := site.Build(nebel.BuildOptions{
+			Verbose: CLI.Generate.Verbose,
+			Quiet:   CLI.Generate.Quiet,
+			Report:  CLI.Generate.Report,
+			DryRun:  CLI.Generate.DryRun,
+		})
+		if err != nil {
+			fatal(err)
+		}
+	case "clean":
+		if err := site.Clean(CLI.Clean.DryRun); err != nil {
+			fatal(err)
+		}
+	case "list":
+		err := site.ListPosts(nebel.ListOptions{
+			Tag:     CLI.List.Tag,
+			Since:   CLI.List.Since,
+			Drafts:  CLI.List.Drafts,
+			Sort:    CLI.List.Sort,
+			Reverse: CLI.List.Reverse,
+			JSON:    CLI.List.JSON,
+		})
+		if err != nil {
+			fatal(err)
+		}
+	case "stats":
+		if err := site.PrintStats(CLI.Stats.JSON); err != nil {
+			fatal(err)
+		}
+	case "import <file>":
+		err := site.ImportPosts(CLI.Import.File, nebel.ImportOptions{
+			From:        CLI.Import.From,
+			Images:      CLI.Import.Images,
+			AliasPrefix: CLI.Import.AliasPrefix,
+		})
+		if err != nil {
+			fatal(err)
+		}
+	case "export epub":
+		if CLI.Export.Epub.FetchLinkCards {
+			site.LinkCards = nebel.DefaultLinkCardFetcher
+		}
+		err := site.ExportEPUB(nebel.EPUBOptions{
+			Output:   CLI.Export.Epub.Output,
+			Title:    CLI.Export.Epub.Title,
+			Tag:      CLI.Export.Epub.Tag,
+			Since:    CLI.Export.Epub.Since,
+			Until:    CLI.Export.Epub.Until,
+			Language: CLI.Export.Epub.Language,
+		})
 		if err != nil {
-			panic(err)
+			fatal(err)
+		}
+	case "og", "og <post>":
+		var err error
+		if CLI.Og.Sheet {
+			err = site.WriteOGSheet(CLI.Og.Output)
+		} else {
+			err = site.PreviewOGImage(CLI.Og.Post, CLI.Og.Title, CLI.Og.Output)
+		}
+		if err != nil {
+			fatal(err)
 		}
 	default:
 		panic(ctx.Command())
 	}
 }
+
+// fatal prints err and exits with its code: 1 for most errors, 2 for usage
+// errors and 3 to 9 for a build that failed in the config, parse, render,
+// template, og, copy or prune phase.
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "nebel:", err)
+	os.Exit(nebel.ExitCode(err))
+}
@@ -0,0 +1,227 @@
+package nebel
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeBlockInfo is the parsed info string of a fenced code block, e.g.
+//
+//	```go:main.go {3-5,8 linenos}
+//	```diff-go:main.go
+type codeBlockInfo struct {
+	Lang        string
+	Filename    string
+	Diff        bool
+	Highlight   [][2]int
+	LineNumbers bool
+	LineStart   int
+}
+
+func parseCodeBlockInfo(info string, lineNumbers bool) codeBlockInfo {
+	cb := codeBlockInfo{LineNumbers: lineNumbers, LineStart: 1}
+
+	head, attrs, _ := strings.Cut(info, "{")
+	attrs, _, _ = strings.Cut(attrs, "}")
+
+	if fields := strings.Fields(head); len(fields) > 0 {
+		cb.Lang, cb.Filename, _ = strings.Cut(fields[0], ":")
+	}
+
+	// "diff-go" means a diff whose lines are highlighted as Go
+	if lang, ok := strings.CutPrefix(cb.Lang, "diff-"); ok && lang != "" {
+		cb.Lang = lang
+		cb.Diff = true
+	}
+
+	for _, field := range strings.FieldsFunc(attrs, func(r rune) bool { return r == ',' || r == ' ' }) {
+		switch {
+		case field == "linenos":
+			cb.LineNumbers = true
+		case field == "nolinenos":
+			cb.LineNumbers = false
+		case strings.HasPrefix(field, "start="):
+			if n, err := strconv.Atoi(strings.TrimPrefix(field, "start=")); err == nil {
+				cb.LineStart = n
+			}
+		default:
+			if r, ok := parseLineRange(field); ok {
+				cb.Highlight = append(cb.Highlight, r)
+			}
+		}
+	}
+
+	return cb
+}
+
+// parseLineRange parses "3" or "3-5" into an inclusive range of line numbers.
+func parseLineRange(s string) ([2]int, bool) {
+	from, to, isRange := strings.Cut(s, "-")
+
+	lhs, err := strconv.Atoi(from)
+	if err != nil {
+		return [2]int{}, false
+	}
+
+	rhs := lhs
+	if isRange {
+		rhs, err = strconv.Atoi(to)
+		if err != nil || rhs < lhs {
+			return [2]int{}, false
+		}
+	}
+
+	return [2]int{lhs, rhs}, true
+}
+
+func (cb codeBlockInfo) highlighted(line int) bool {
+	for _, r := range cb.Highlight {
+		if line >= r[0] && line <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// splitDiffMarkers strips the leading +, - or space from each line of a
+// diff and returns the remaining code along with the marker of each line.
+func splitDiffMarkers(code string) (string, []byte) {
+	var b strings.Builder
+	var markers []byte
+
+	for _, line := range strings.SplitAfter(code, "\n") {
+		if line == "" {
+			continue
+		}
+
+		marker := byte(' ')
+		switch line[0] {
+		case '+', '-':
+			marker = line[0]
+			line = line[1:]
+		case ' ':
+			line = line[1:]
+		}
+
+		markers = append(markers, marker)
+		b.WriteString(line)
+	}
+
+	return b.String(), markers
+}
+
+// codeBlockExtension renders fenced code blocks with Chroma, adding a
+// filename caption, highlighted lines, line numbers, diff coloring and a
+// copy button.
+type codeBlockExtension struct {
+	lineNumbers bool
+	// lexers are the site's own, looked up before Chroma's.
+	lexers lexerSet
+}
+
+func (e *codeBlockExtension) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(e, 200),
+	))
+}
+
+func (e *codeBlockExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, e.renderFencedCodeBlock)
+}
+
+func (e *codeBlockExtension) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+
+	var info string
+	if n.Info != nil {
+		info = string(n.Info.Segment.Value(source))
+	}
+	cb := parseCodeBlockInfo(info, e.lineNumbers)
+
+	var code strings.Builder
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code.Write(line.Value(source))
+	}
+
+	src := code.String()
+	var markers []byte
+	if cb.Diff {
+		src, markers = splitDiffMarkers(src)
+	}
+
+	lexer := e.lexers.get(cb.Lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, src)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+
+	lines := chroma.SplitTokensIntoLines(iterator.Tokens())
+	lineDigits := len(strconv.Itoa(cb.LineStart + len(lines) - 1))
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.PreventSurroundingPre(true),
+	)
+
+	_, _ = w.WriteString("<figure class=\"code-block\"")
+	if cb.Lang != "" {
+		fmt.Fprintf(w, " data-lang=\"%s\"", html.EscapeString(cb.Lang))
+	}
+	_, _ = w.WriteString(">\n")
+	if cb.Filename != "" {
+		fmt.Fprintf(w, "<figcaption class=\"code-title\">%s</figcaption>\n", html.EscapeString(cb.Filename))
+	}
+	_, _ = w.WriteString("<button type=\"button\" class=\"code-copy\" aria-label=\"Copy code\">Copy</button>\n")
+
+	_, _ = w.WriteString("<pre tabindex=\"0\" class=\"chroma\"><code>")
+	for i, tokens := range lines {
+		lineNo := cb.LineStart + i
+
+		class := "line"
+		if cb.highlighted(lineNo) {
+			class += " hl"
+		}
+		if i < len(markers) {
+			switch markers[i] {
+			case '+':
+				class += " diff-add"
+			case '-':
+				class += " diff-del"
+			}
+		}
+
+		fmt.Fprintf(w, "<span class=\"%s\">", class)
+		if cb.LineNumbers {
+			fmt.Fprintf(w, "<span class=\"ln\">%*d</span>", lineDigits, lineNo)
+		}
+		_, _ = w.WriteString("<span class=\"cl\">")
+		if err := formatter.Format(w, styles.Fallback, chroma.Literator(tokens...)); err != nil {
+			return ast.WalkStop, err
+		}
+		_, _ = w.WriteString("</span></span>")
+	}
+	_, _ = w.WriteString("</code></pre>\n")
+	_, _ = w.WriteString("</figure>\n")
+
+	return ast.WalkContinue, nil
+}
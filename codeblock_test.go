@@ -0,0 +1,44 @@
+package nebel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCodeBlockInfo(t *testing.T) {
+	tests := []struct {
+		info        string
+		lineNumbers bool
+		want        codeBlockInfo
+	}{
+		{"", false, codeBlockInfo{LineStart: 1}},
+		{"go", false, codeBlockInfo{Lang: "go", LineStart: 1}},
+		{"go:main.go", false, codeBlockInfo{Lang: "go", Filename: "main.go", LineStart: 1}},
+		{"diff-go:main.go", false, codeBlockInfo{Lang: "go", Filename: "main.go", Diff: true, LineStart: 1}},
+		{"diff", false, codeBlockInfo{Lang: "diff", LineStart: 1}},
+		{"diff-", false, codeBlockInfo{Lang: "diff-", LineStart: 1}},
+		{"go {3-5,8}", false, codeBlockInfo{Lang: "go", Highlight: [][2]int{{3, 5}, {8, 8}}, LineStart: 1}},
+		{"go {linenos start=10}", false, codeBlockInfo{Lang: "go", LineNumbers: true, LineStart: 10}},
+		{"go {nolinenos}", true, codeBlockInfo{Lang: "go", LineStart: 1}},
+		{"go", true, codeBlockInfo{Lang: "go", LineNumbers: true, LineStart: 1}},
+		{"go:main.go {2 linenos}", false, codeBlockInfo{Lang: "go", Filename: "main.go", Highlight: [][2]int{{2, 2}}, LineNumbers: true, LineStart: 1}},
+		// Invalid ranges and options are ignored
+		{"go {5-3, x, start=y}", false, codeBlockInfo{Lang: "go", LineStart: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := parseCodeBlockInfo(tt.info, tt.lineNumbers); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCodeBlockInfo(%q, %v) = %+v, want %+v", tt.info, tt.lineNumbers, got, tt.want)
+		}
+	}
+}
+
+func TestSplitDiffMarkers(t *testing.T) {
+	code, markers := splitDiffMarkers("+added\n-removed\n kept\nbare\n")
+	if want := "added\nremoved\nkept\nbare\n"; code != want {
+		t.Errorf("code = %q, want %q", code, want)
+	}
+	if want := "+-  "; string(markers) != want {
+		t.Errorf("markers = %q, want %q", markers, want)
+	}
+}
@@ -0,0 +1,197 @@
+package nebel
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+const configPath = "config.yaml"
+
+// Config is the site configuration read from config.yaml. Every field is
+// optional; a site without config.yaml builds with the defaults.
+type Config struct {
+	// Title is the site name, used for pages that aren't a single post.
+	Title string `yaml:"title"`
+	// Description is the site summary shared with the index page.
+	Description string `yaml:"description"`
+	// BaseURL is the URL the site is served from, e.g.
+	// https://mizzy.org. Canonical and OG URLs are relative without it.
+	BaseURL string `yaml:"base_url"`
+
+	// Author and Publisher are used in JSON-LD. The publisher defaults to
+	// the site itself.
+	Author    AuthorConfig    `yaml:"author"`
+	Publisher PublisherConfig `yaml:"publisher"`
+
+	Highlight HighlightConfig `yaml:"highlight"`
+	OG        OGTheme         `yaml:"og"`
+}
+
+type AuthorConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+type PublisherConfig struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Logo is a site path such as /images/logo.png.
+	Logo string `yaml:"logo"`
+}
+
+type HighlightConfig struct {
+	// LightStyle and DarkStyle are Chroma style names used to generate
+	// public/css/chroma.css. DarkStyle applies under prefers-color-scheme:
+	// dark and is omitted when empty.
+	LightStyle string `yaml:"light_style"`
+	DarkStyle  string `yaml:"dark_style"`
+
+	// LineNumbers shows line numbers on every code block. A fence can still
+	// turn them on or off with {linenos} or {nolinenos}.
+	LineNumbers bool `yaml:"line_numbers"`
+}
+
+// OGTheme controls how generated OG images look. Paths are relative to
+// the site root.
+type OGTheme struct {
+	Background OGBackground `yaml:"background"`
+
+	// TitleColor and FooterColor are #rrggbb or #rrggbbaa.
+	TitleColor  string `yaml:"title_color"`
+	FooterColor string `yaml:"footer_color"`
+
+	// Font and FooterFont are font files; the embedded Noto Sans CJK JP
+	// Bold is used when empty.
+	Font       string `yaml:"font"`
+	FooterFont string `yaml:"footer_font"`
+
+	// FallbackFonts are tried in order for characters the font lacks,
+	// e.g. Noto Sans KR, Noto Sans Thai or the monochrome Noto Emoji.
+	// Color emoji fonts (CBDT, sbix, COLR) can't be drawn.
+	FallbackFonts []string `yaml:"fallback_fonts"`
+
+	// MaxLines is how many lines a title may wrap onto before the font
+	// size is reduced.
+	MaxLines int `yaml:"max_lines"`
+
+	Avatar  OGAvatar  `yaml:"avatar"`
+	Footer  OGFooter  `yaml:"footer"`
+	Padding OGPadding `yaml:"padding"`
+
+	// Variants are the sizes and formats each image is written in. The
+	// first is the page's main image, ogp.png or ogp.jpg; the others are
+	// written as ogp-<name>.png or ogp-<name>.jpg.
+	Variants []OGVariant `yaml:"variants"`
+}
+
+type OGBackground struct {
+	// Type is "solid", "gradient" or "image".
+	Type   string   `yaml:"type"`
+	Color  string   `yaml:"color"`
+	Colors []string `yaml:"colors"`
+	// Angle of a gradient in degrees; 0 runs left to right.
+	Angle float64 `yaml:"angle"`
+	Image string  `yaml:"image"`
+}
+
+type OGVariant struct {
+	// Name defaults to <width>x<height>.
+	Name   string `yaml:"name"`
+	Width  int    `yaml:"width"`
+	Height int    `yaml:"height"`
+	// Format is "png", the default, or "jpeg".
+	Format string `yaml:"format"`
+	// Quality of a JPEG from 1 to 100; 85 when zero.
+	Quality int `yaml:"quality"`
+	// Colors quantizes a PNG to a palette of at most this many colors, up
+	// to 256, which makes it several times smaller. Zero keeps full color.
+	Colors int `yaml:"colors"`
+}
+
+type OGAvatar struct {
+	// Path is an image file; the embedded avatar is used when empty.
+	Path string `yaml:"path"`
+	// Shape is "circle", "rounded", "square" or "none" to hide the avatar.
+	Shape string  `yaml:"shape"`
+	Size  float64 `yaml:"size"`
+}
+
+type OGFooter struct {
+	Text       string `yaml:"text"`
+	DateFormat string `yaml:"date_format"`
+}
+
+type OGPadding struct {
+	// X is the space left and right of the title.
+	X            float64 `yaml:"x"`
+	FooterRight  float64 `yaml:"footer_right"`
+	FooterBottom float64 `yaml:"footer_bottom"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Highlight: HighlightConfig{
+			LightStyle: "nord",
+		},
+		OG: OGTheme{
+			Background: OGBackground{
+				Type:  "solid",
+				Color: "#ffffff",
+			},
+			TitleColor:  "#2d2d2d",
+			FooterColor: "#2d2d2d",
+			MaxLines:    2,
+			Avatar: OGAvatar{
+				Shape: "circle",
+				Size:  44,
+			},
+			Footer: OGFooter{
+				Text:       "mizzy.org",
+				DateFormat: "2006-01-02",
+			},
+			Padding: OGPadding{
+				X:            80,
+				FooterRight:  60,
+				FooterBottom: 55,
+			},
+			Variants: []OGVariant{
+				{Width: 1200, Height: 630, Format: "png"},
+			},
+		},
+	}
+}
+
+// siteName is the configured title, or the OG footer text for sites that
+// don't set one.
+func (c *Config) siteName() string {
+	if c.Title != "" {
+		return c.Title
+	}
+	return c.OG.Footer.Text
+}
+
+// absURL makes a site path absolute with BaseURL.
+func (c *Config) absURL(path string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + path
+}
+
+func loadConfig(src fs.FS) (*Config, error) {
+	config := defaultConfig()
+
+	data, err := fs.ReadFile(src, configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, buildError(PhaseConfig, configPath, err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, buildError(PhaseConfig, configPath, err)
+	}
+
+	return config, nil
+}
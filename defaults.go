@@ -0,0 +1,46 @@
+package nebel
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"path"
+	"text/template"
+)
+
+// defaultSite holds the layouts, static files and archetypes used when a
+// site doesn't have its own, and the config and sample post nebel init
+// starts a site with.
+//
+//go:embed defaults
+var defaultSite embed.FS
+
+// readSiteFile reads name from src, or from the defaults when the site
+// doesn't have it.
+func readSiteFile(src fs.FS, name string) ([]byte, error) {
+	data, err := fs.ReadFile(src, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if data, err := defaultSite.ReadFile(path.Join("defaults", name)); err == nil {
+			return data, nil
+		}
+	}
+	return data, err
+}
+
+// parseLayout parses layouts/<name>.
+func parseLayout(src fs.FS, name string, config *Config) (*template.Template, error) {
+	data, err := readSiteFile(src, path.Join("layouts", name))
+	if err != nil {
+		return nil, err
+	}
+	return template.New(name).Funcs(templateFuncs(config)).Parse(string(data))
+}
+
+// defaultStatic is the default static/ directory.
+func defaultStatic() fs.FS {
+	static, err := fs.Sub(defaultSite, "defaults/static")
+	if err != nil {
+		panic(err)
+	}
+	return static
+}
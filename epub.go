@@ -0,0 +1,535 @@
+package nebel
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EPUBOptions select the posts of an e-book and how it's written.
+type EPUBOptions struct {
+	Output string
+	// Title defaults to the site name, followed by the tag if there is one.
+	Title string
+	// Tag keeps posts with this tag.
+	Tag string
+	// Since and Until keep posts on or between these dates, "2006-01-02".
+	Since string
+	Until string
+	// Language is a BCP 47 tag; "ja" when empty.
+	Language string
+}
+
+// Media types EPUB 3 reading systems must support for images
+var epubImageTypes = []string{"image/gif", "image/jpeg", "image/png", "image/svg+xml", "image/webp"}
+
+type epubItem struct {
+	ID string
+	// Title is the table of contents entry of a chapter.
+	Title      string
+	Href       string
+	MediaType  string
+	Properties string
+	Data       []byte
+}
+
+type epubBook struct {
+	// src is the site the posts' images are read from.
+	src       fs.FS
+	config    *Config
+	title     string
+	language  string
+	chapters  []epubItem
+	resources []epubItem
+	// images maps an image URL in a post to its href in the book.
+	images map[string]string
+}
+
+// ExportEPUB writes the published posts matching opts as an EPUB 3 book,
+// one chapter a post, with the posts' images, highlighted code and the
+// embedded Noto Sans CJK font.
+func (s *Site) ExportEPUB(opts EPUBOptions) error {
+	config, err := loadConfig(s.Source)
+	if err != nil {
+		return err
+	}
+
+	siteLexers, err := loadSiteLexers(s.Source)
+	if err != nil {
+		return err
+	}
+
+	since, until, err := parseDateRange(opts.Since, opts.Until)
+	if err != nil {
+		return err
+	}
+
+	posts, err := loadPosts(s.Source)
+	if err != nil {
+		return err
+	}
+
+	var selected []*Post
+	for _, post := range publishedPosts(posts) {
+		if opts.Tag != "" && !slices.Contains(post.Tags, opts.Tag) {
+			continue
+		}
+		if post.Date.Before(since) || (!until.IsZero() && !post.Date.Before(until)) {
+			continue
+		}
+		selected = append(selected, post)
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no posts to export")
+	}
+
+	linkCards, err := loadLinkCardCache(s.Source, s.LinkCardCache, s.LinkCards)
+	if err != nil {
+		return err
+	}
+	linkCards.warn = func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, "warning: "+format+"\n", args...)
+	}
+
+	md := newMarkdown(config, siteLexers, linkCards)
+	for _, post := range selected {
+		if err := post.convertMarkdown(md); err != nil {
+			return fmt.Errorf("%s: %w", post.SourcePath, err)
+		}
+	}
+
+	if err := linkCards.save(); err != nil {
+		return err
+	}
+
+	book := &epubBook{
+		src:      s.Source,
+		config:   config,
+		title:    opts.Title,
+		language: opts.Language,
+		images:   map[string]string{},
+	}
+	if book.title == "" {
+		book.title = config.siteName()
+		if opts.Tag != "" {
+			book.title += " - " + opts.Tag
+		}
+	}
+	if book.language == "" {
+		book.language = "ja"
+	}
+
+	for i, post := range selected {
+		if err := book.addChapter(i+1, post); err != nil {
+			return fmt.Errorf("%s: %w", post.SourcePath, err)
+		}
+	}
+
+	css, err := epubCSS(config)
+	if err != nil {
+		return err
+	}
+	book.resources = append(book.resources,
+		epubItem{ID: "style", Href: "style.css", MediaType: "text/css", Data: css},
+		epubItem{ID: "font", Href: "fonts/NotoSansCJKjp-Bold.otf", MediaType: "font/otf", Data: fontData},
+	)
+
+	return writeOutput(opts.Output, book.write)
+}
+
+// parseDateRange parses an optional start date and an optional end date,
+// returning the end as the start of the day after it.
+func parseDateRange(since, until string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if since != "" {
+		if from, err = time.ParseInLocation("2006-01-02", since, postLocation); err != nil {
+			return from, to, fmt.Errorf("invalid date %q", since)
+		}
+	}
+	if until != "" {
+		if to, err = time.ParseInLocation("2006-01-02", until, postLocation); err != nil {
+			return from, to, fmt.Errorf("invalid date %q", until)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+func (b *epubBook) addChapter(n int, post *Post) error {
+	body := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(post.ParsedContent), body)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+	b.prepareNode(body)
+
+	var content bytes.Buffer
+	for node := body.FirstChild; node != nil; node = node.NextSibling {
+		writeXHTML(&content, node)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, epubPageHeader, b.language, b.language, html.EscapeString(post.Title), "../")
+	fmt.Fprintf(&buf, "<section epub:type=\"chapter\">\n<h1>%s</h1>\n<p class=\"date\">%s</p>\n",
+		html.EscapeString(post.Title), post.Date.Format("2006-01-02"))
+	buf.Write(content.Bytes())
+	buf.WriteString("\n</section>\n</body>\n</html>\n")
+
+	item := epubItem{
+		ID:        fmt.Sprintf("post-%03d", n),
+		Title:     post.Title,
+		Href:      fmt.Sprintf("posts/%03d.xhtml", n),
+		MediaType: "application/xhtml+xml",
+		Data:      buf.Bytes(),
+	}
+	if containsSVG(body) {
+		item.Properties = "svg"
+	}
+	b.chapters = append(b.chapters, item)
+	return nil
+}
+
+// prepareNode makes the HTML of a post fit for the book: images are
+// embedded, site links made absolute, and scripts and embeds, which
+// reading systems don't run, replaced.
+func (b *epubBook) prepareNode(n *xhtml.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == xhtml.ElementNode {
+			switch child.DataAtom {
+			case atom.Script, atom.Button:
+				n.RemoveChild(child)
+			case atom.Iframe:
+				// Keep a link to what was embedded
+				src := attr(child, "src")
+				link := &xhtml.Node{Type: xhtml.ElementNode, Data: "a", DataAtom: atom.A,
+					Attr: []xhtml.Attribute{{Key: "href", Val: src}}}
+				link.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: src})
+				n.InsertBefore(link, child)
+				n.RemoveChild(child)
+			default:
+				b.prepareNode(child)
+			}
+		}
+		child = next
+	}
+
+	if n.Type != xhtml.ElementNode {
+		return
+	}
+	// XHTML requires alt on every image
+	if n.DataAtom == atom.Img && !hasAttr(n, "alt") {
+		n.Attr = append(n.Attr, xhtml.Attribute{Key: "alt"})
+	}
+	for i, a := range n.Attr {
+		switch {
+		case n.DataAtom == atom.Img && a.Key == "src":
+			n.Attr[i].Val = b.image(a.Val)
+		case n.DataAtom == atom.A && a.Key == "href" && strings.HasPrefix(a.Val, "/"):
+			n.Attr[i].Val = b.config.absURL(a.Val)
+		}
+	}
+}
+
+func hasAttr(n *xhtml.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+var epubHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// image adds the image at src, a site path or a URL, to the book and
+// returns its href from a chapter. Images that can't be loaded keep src.
+func (b *epubBook) image(src string) string {
+	if href, ok := b.images[src]; ok {
+		return href
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(src, "/"):
+		data, err = readSourceFile(b.src, sitePath(src))
+	case strings.HasPrefix(src, "http://"), strings.HasPrefix(src, "https://"):
+		data, err = fetchImage(src)
+	default:
+		return src
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s: %v\n", src, err)
+		return src
+	}
+
+	ext := strings.ToLower(path.Ext(strings.SplitN(src, "?", 2)[0]))
+	mediaType := mime.TypeByExtension(ext)
+	if !slices.Contains(epubImageTypes, mediaType) {
+		mediaType = http.DetectContentType(data)
+	}
+	if !slices.Contains(epubImageTypes, mediaType) {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s images aren't supported in EPUB\n", src, mediaType)
+		return src
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); !slices.Contains(exts, ext) && len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	id := fmt.Sprintf("img-%03d", len(b.images)+1)
+	b.resources = append(b.resources, epubItem{
+		ID:        id,
+		Href:      "images/" + id + ext,
+		MediaType: mediaType,
+		Data:      data,
+	})
+
+	href := "../images/" + id + ext
+	b.images[src] = href
+	return href
+}
+
+func fetchImage(url string) ([]byte, error) {
+	resp, err := epubHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func containsSVG(n *xhtml.Node) bool {
+	if n.Type == xhtml.ElementNode && n.Data == "svg" {
+		return true
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if containsSVG(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTML elements that have no end tag, which XHTML writes self-closed
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Base: true, atom.Br: true, atom.Col: true, atom.Embed: true,
+	atom.Hr: true, atom.Img: true, atom.Input: true, atom.Link: true, atom.Meta: true,
+	atom.Source: true, atom.Track: true, atom.Wbr: true,
+}
+
+var xmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// writeXHTML serializes n as XHTML, which EPUB requires. Raw HTML in posts
+// need not be well-formed XML, so the parsed tree is written out again
+// rather than the post's HTML.
+func writeXHTML(w *bytes.Buffer, n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		w.WriteString(html.EscapeString(n.Data))
+		return
+	case xhtml.ElementNode:
+	default:
+		return
+	}
+
+	w.WriteString("<" + n.Data)
+	if n.Data == "svg" {
+		w.WriteString(` xmlns="http://www.w3.org/2000/svg"`)
+	}
+	for _, a := range n.Attr {
+		// Attributes XML can't name, such as @click, are dropped
+		if a.Namespace != "" || !xmlName.MatchString(a.Key) || a.Key == "xmlns" {
+			continue
+		}
+		fmt.Fprintf(w, ` %s="%s"`, a.Key, html.EscapeString(a.Val))
+	}
+
+	if voidElements[n.DataAtom] {
+		w.WriteString(" />")
+		return
+	}
+
+	w.WriteString(">")
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeXHTML(w, child)
+	}
+	w.WriteString("</" + n.Data + ">")
+}
+
+// epubCSS styles the book with the light highlight style. Headings use the
+// embedded font, which is bold only; body text is left to the reader.
+func epubCSS(config *Config) ([]byte, error) {
+	style, err := chromaStyle(config.Highlight.LightStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(epubBaseCSS)
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, style); err != nil {
+		return nil, err
+	}
+	writeCodeBlockCSS(&buf, style)
+	return buf.Bytes(), nil
+}
+
+const epubBaseCSS = `@font-face {
+  font-family: "Noto Sans CJK JP";
+  font-weight: bold;
+  src: url("fonts/NotoSansCJKjp-Bold.otf");
+}
+h1, h2, h3, h4, h5, h6 { font-family: "Noto Sans CJK JP", sans-serif; font-weight: bold; }
+p.date { color: #666; }
+img { max-width: 100%; }
+pre { white-space: pre-wrap; font-size: 0.85em; }
+figure.code-block { margin: 1em 0; }
+.code-title { font-family: monospace; font-size: 0.85em; }
+.chroma .line { display: block; }
+.chroma .ln { margin-right: 1em; color: #999; }
+.link-card { border: 1px solid #ccc; padding: 0.5em; margin: 1em 0; }
+.link-card-image img { max-height: 8em; }
+`
+
+const epubPageHeader = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%s" lang="%s">
+<head>
+<meta charset="utf-8" />
+<title>%s</title>
+<link rel="stylesheet" type="text/css" href="%sstyle.css" />
+</head>
+<body>
+`
+
+// write writes the book as a zip file, the mimetype entry first and
+// uncompressed as EPUB requires.
+func (b *epubBook) write(w io.Writer) error {
+	z := zip.NewWriter(w)
+
+	mimetype, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"META-INF/container.xml", []byte(epubContainer)},
+		{"OEBPS/content.opf", b.packageDocument()},
+		{"OEBPS/nav.xhtml", b.navDocument()},
+	}
+	for _, item := range slices.Concat(b.chapters, b.resources) {
+		files = append(files, struct {
+			name string
+			data []byte
+		}{"OEBPS/" + item.Href, item.Data})
+	}
+
+	for _, file := range files {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(file.data); err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="utf-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml" />
+  </rootfiles>
+</container>
+`
+
+func (b *epubBook) packageDocument() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%s">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="book-id">%s</dc:identifier>
+<dc:title>%s</dc:title>
+<dc:language>%s</dc:language>
+`, b.language, b.identifier(), html.EscapeString(b.title), b.language)
+	if b.config.Author.Name != "" {
+		fmt.Fprintf(&buf, "<dc:creator>%s</dc:creator>\n", html.EscapeString(b.config.Author.Name))
+	}
+	fmt.Fprintf(&buf, "<meta property=\"dcterms:modified\">%s</meta>\n</metadata>\n<manifest>\n",
+		time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+
+	buf.WriteString("<item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\" />\n")
+	for _, item := range slices.Concat(b.chapters, b.resources) {
+		fmt.Fprintf(&buf, "<item id=\"%s\" href=\"%s\" media-type=\"%s\"", item.ID, item.Href, item.MediaType)
+		if item.Properties != "" {
+			fmt.Fprintf(&buf, " properties=\"%s\"", item.Properties)
+		}
+		buf.WriteString(" />\n")
+	}
+
+	buf.WriteString("</manifest>\n<spine>\n<itemref idref=\"nav\" />\n")
+	for _, item := range b.chapters {
+		fmt.Fprintf(&buf, "<itemref idref=\"%s\" />\n", item.ID)
+	}
+	buf.WriteString("</spine>\n</package>\n")
+
+	return buf.Bytes()
+}
+
+func (b *epubBook) navDocument() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, epubPageHeader, b.language, b.language, html.EscapeString(b.title), "")
+	fmt.Fprintf(&buf, "<h1>%s</h1>\n<nav epub:type=\"toc\" id=\"toc\">\n<ol>\n", html.EscapeString(b.title))
+	for _, item := range b.chapters {
+		fmt.Fprintf(&buf, "<li><a href=\"%s\">%s</a></li>\n", item.Href, html.EscapeString(item.Title))
+	}
+	buf.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return buf.Bytes()
+}
+
+// identifier is a name-based UUID of the book's title and chapters, so
+// exporting the same posts again gives the same book.
+func (b *epubBook) identifier() string {
+	h := sha1.New()
+	io.WriteString(h, b.title)
+	for _, item := range b.chapters {
+		io.WriteString(h, "\x00"+item.Title)
+	}
+	sum := h.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
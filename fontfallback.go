@@ -0,0 +1,97 @@
+package nebel
+
+import (
+	"image"
+	"io/fs"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontChain is a list of fonts tried in order for each rune, so characters
+// missing from the first font (emoji, Hangul, Thai, ...) are drawn with the
+// next font that has them instead of as tofu.
+type fontChain []*opentype.Font
+
+func loadFontChain(src fs.FS, primary string, fallbacks []string) (fontChain, error) {
+	var chain fontChain
+	for _, path := range append([]string{primary}, fallbacks...) {
+		f, err := loadFont(src, path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, f)
+	}
+	return chain, nil
+}
+
+// face returns a font.Face of the given size that picks a font per rune.
+func (c fontChain) face(size float64) (font.Face, error) {
+	ff := &fallbackFace{fonts: c}
+	for _, f := range c {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{
+			Size:    size,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ff.faces = append(ff.faces, face)
+	}
+	return ff, nil
+}
+
+// fallbackFace implements font.Face on top of several faces, delegating
+// each rune to the first face whose font has a glyph for it. Metrics come
+// from the first face.
+type fallbackFace struct {
+	fonts fontChain
+	faces []font.Face
+	buf   sfnt.Buffer
+}
+
+func (f *fallbackFace) faceFor(r rune) font.Face {
+	for i, fnt := range f.fonts {
+		if idx, err := fnt.GlyphIndex(&f.buf, r); err == nil && idx != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		if err := face.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faceFor(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faceFor(r).GlyphAdvance(r)
+}
+
+// Kern only applies between runes drawn with the same font.
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	face := f.faceFor(r0)
+	if face != f.faceFor(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
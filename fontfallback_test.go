@@ -0,0 +1,65 @@
+package nebel
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+func TestFallbackFace(t *testing.T) {
+	latin, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cjk, err := opentype.Parse(fontData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf sfnt.Buffer
+	if idx, err := cjk.GlyphIndex(&buf, '日'); err != nil || idx == 0 {
+		t.Skip("the bundled font has no CJK glyphs")
+	}
+
+	face, err := fontChain{latin, cjk}.face(48)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ff := face.(*fallbackFace)
+
+	tests := []struct {
+		r    rune
+		want int
+	}{
+		{'A', 0},
+		{'é', 0},
+		{'日', 1},
+		{'あ', 1},
+		{'ー', 1},
+		// In neither font, so the primary face draws tofu
+		{'\U0010FFFD', 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.r), func(t *testing.T) {
+			want := ff.faces[tt.want]
+			if got := ff.faceFor(tt.r); got != want {
+				t.Errorf("faceFor(%q) isn't face %d", tt.r, tt.want)
+			}
+
+			advance, ok := want.GlyphAdvance(tt.r)
+			if got, gotOK := ff.GlyphAdvance(tt.r); got != advance || gotOK != ok {
+				t.Errorf("GlyphAdvance(%q) = %v, %v, want %v, %v", tt.r, got, gotOK, advance, ok)
+			}
+			if got := font.MeasureString(ff, string(tt.r)); got != advance {
+				t.Errorf("MeasureString(%q) = %v, want %v", tt.r, got, advance)
+			}
+		})
+	}
+
+	if ff.Metrics() != ff.faces[0].Metrics() {
+		t.Error("Metrics() aren't the primary face's")
+	}
+}
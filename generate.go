@@ -3,27 +3,37 @@ package nebel
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"html"
+	"io"
+	"io/fs"
+	"path"
 	"regexp"
+	"slices"
 	"sort"
-	"text/template"
+	"strings"
 	"time"
 
-	"github.com/alecthomas/chroma/v2/formatters/html"
 	"github.com/goccy/go-yaml"
 	"github.com/yosssi/gohtml"
 	"github.com/yuin/goldmark"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/extension"
 	gmhtml "github.com/yuin/goldmark/renderer/html"
 	"go.abhg.dev/goldmark/mermaid"
 )
 
 type Header struct {
-	Title string `yaml:"title"`
-	Date  string `yaml:"date"`
+	Title      string   `yaml:"title"`
+	Date       string   `yaml:"date"`
+	OGImage    string   `yaml:"og_image"`
+	OGCover    string   `yaml:"og_cover"`
+	OGTitle    string   `yaml:"og_title"`
+	OGSubtitle string   `yaml:"og_subtitle"`
+	Summary    string   `yaml:"summary"`
+	Tags       []string `yaml:"tags"`
+	Draft      bool     `yaml:"draft"`
+	Aliases    []string `yaml:"aliases"`
 }
 
 type Post struct {
@@ -37,44 +47,71 @@ type Post struct {
 	FullContent   string
 	Index         bool
 	OGImagePath   string
+	OGImages      []OGImage
+	OGImage       string
+	OGCover       string
+	OGTitle       string
+	OGSubtitle    string
+	Summary       string
+	Tags          []string
+	Draft         bool
+	Aliases       []string
+	SourcePath    string
+	// WordCount counts each CJK character as a word; ReadingTime is in
+	// minutes.
+	WordCount   int
+	ReadingTime int
 }
 
+// Generate builds the site in the current directory into public/.
 func Generate() error {
-	posts, err := createPostObjects()
-	if err != nil {
-		return err
-	}
+	_, err := NewSite(".").Build(BuildOptions{})
+	return err
+}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].Date.Before(posts[j].Date)
-	})
+func processPosts(posts []*Post, config *Config, md goldmark.Markdown) error {
+	for pos, post := range posts {
+		if err := post.convertMarkdown(md); err != nil {
+			return buildError(PhaseRender, post.SourcePath, err)
+		}
+		if post.Summary == "" {
+			post.Summary = summarize(post.ParsedContent, summaryLength)
+		}
 
-	if err := processPosts(posts); err != nil {
-		return err
-	}
+		post.OGImages = ogImages(post.Path, post.OGImage, config.OG.Variants)
+		post.OGImagePath = post.OGImages[0].Path
 
-	if err := writePostFiles(posts); err != nil {
-		return err
+		if pos > 0 {
+			post.PrevPost = posts[pos-1]
+		}
+		if pos < len(posts)-1 {
+			post.NextPost = posts[pos+1]
+		}
 	}
+	return nil
+}
 
-	if err := generateIndexHTML(posts); err != nil {
-		return err
+// loadPosts reads every post, drafts included, sorted by date, and gives
+// the published ones their paths.
+func loadPosts(src fs.FS) ([]*Post, error) {
+	posts, err := createPostObjects(src)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := generateAtomXML(posts); err != nil {
-		return err
-	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Date.Before(posts[j].Date)
+	})
 
-	return copyStaticFiles()
+	assignPaths(publishedPosts(posts))
+	return posts, nil
 }
 
-func processPosts(posts []*Post) error {
+// assignPaths gives each post its /blog/YYYY/MM/DD/N path, numbering the
+// posts of a day in order. posts must be sorted by date.
+func assignPaths(posts []*Post) {
 	count := 1
 	for pos, post := range posts {
-		if err := post.convertMarkdown(); err != nil {
-			return err
-		}
-
 		currentDate := post.Date.Format("2006/01/02")
 		if pos > 0 && posts[pos-1].Date.Format("2006/01/02") == currentDate {
 			count++
@@ -83,93 +120,197 @@ func processPosts(posts []*Post) error {
 		}
 
 		post.Path = fmt.Sprintf("/blog/%s/%d", currentDate, count)
-		post.OGImagePath = post.Path + "/ogp.png"
+	}
+}
 
-		if pos > 0 {
-			post.PrevPost = posts[pos-1]
+// olderPosts are all but the last nine posts, whose pages are always
+// written; older pages are only written when they changed or are missing.
+func olderPosts(posts []*Post) []*Post {
+	return posts[:max(len(posts)-9, 0)]
+}
+
+func writePostFiles(src fs.FS, out Output, posts []*Post, config *Config, log *buildLog) error {
+	older := len(olderPosts(posts))
+	for i, post := range posts {
+		if err := post.processLayout(src, config); err != nil {
+			return buildError(PhaseTemplate, post.SourcePath, err)
 		}
-		if pos < len(posts)-1 {
-			post.NextPost = posts[pos+1]
+
+		name := postOutputName(post, "index.html")
+		data := []byte(formatHTML(post.FullContent))
+		log.sums[name] = sumBytes(data)
+		if i < older && log.upToDate(out, name, log.sums[name]) {
+			log.keep(name)
+			continue
 		}
+
+		if err := out.WriteFile(name, data); err != nil {
+			return buildError(PhaseTemplate, name, err)
+		}
+		log.page(name)
 	}
 	return nil
 }
 
-func writePostFiles(posts []*Post) error {
-	for pos, post := range posts {
-		if err := post.processLayout(); err != nil {
-			return err
-		}
+// postOutputName is the name in the output of a file in the post's
+// directory.
+func postOutputName(post *Post, file string) string {
+	return path.Join(strings.TrimPrefix(post.Path, "/"), file)
+}
 
-		if pos > len(posts)-10 {
-			outputDir := filepath.Join("public", post.Path)
-			if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
-				return err
+// writeOGImages writes the OG images of the recent posts, those of older
+// posts that changed or are missing, and the index's.
+func writeOGImages(out Output, posts []*Post, config *Config, og *ogRenderer, log *buildLog) error {
+	older := len(olderPosts(posts))
+	for i, post := range posts {
+		sum := post.ogSum(og)
+		upToDate := i < older
+		for _, img := range post.OGImages {
+			name := strings.TrimPrefix(img.Path, "/")
+			log.sums[name] = sum
+			upToDate = upToDate && log.upToDate(out, name, sum)
+		}
+		if upToDate {
+			for _, img := range post.OGImages {
+				log.keep(strings.TrimPrefix(img.Path, "/"))
 			}
+			continue
+		}
+
+		if err := post.generateOGImage(out, postOutputName(post, ""), og); err != nil {
+			return buildError(PhaseOG, post.SourcePath, err)
+		}
+		for _, img := range post.OGImages {
+			log.image(strings.TrimPrefix(img.Path, "/"))
+		}
+	}
+
+	// The index shows the latest post but is shared as the site itself.
+	// There's no index without posts.
+	if len(posts) == 0 {
+		return nil
+	}
+	latestPost := posts[len(posts)-1]
+	if err := og.generatePageOGImage(out, "", config.siteName(), latestPost.Date); err != nil {
+		return buildError(PhaseOG, "", err)
+	}
+	for _, img := range ogImages("", "", config.OG.Variants) {
+		log.image(strings.TrimPrefix(img.Path, "/"))
+	}
+	return nil
+}
 
-			path := filepath.Join(outputDir, "index.html")
-			if err := os.WriteFile(path, []byte(formatHTML(post.FullContent)), 0644); err != nil {
-				return err
+const redirectHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8" />
+<title>Redirecting…</title>
+<link rel="canonical" href="%[1]s" />
+<meta http-equiv="refresh" content="0; url=%[1]s" />
+</head>
+<body><a href="%[1]s">%[1]s</a></body>
+</html>
+`
+
+// writeRedirects writes a page at each alias of a post, such as its URL on
+// a blog it was imported from, that redirects to the post.
+func writeRedirects(out Output, posts []*Post, config *Config, log *buildLog) error {
+	for _, post := range posts {
+		target := html.EscapeString(config.absURL(post.Path + "/"))
+		for _, alias := range post.Aliases {
+			name := strings.TrimPrefix(path.Clean("/"+alias), "/")
+			if path.Ext(name) != ".html" {
+				name = path.Join(name, "index.html")
 			}
 
-			// Generate OGP image
-			if err := post.generateOGImage(outputDir); err != nil {
-				return err
+			if err := out.WriteFile(name, []byte(fmt.Sprintf(redirectHTML, target))); err != nil {
+				return buildError(PhaseTemplate, post.SourcePath, err)
 			}
+			log.page(name)
 		}
 	}
 	return nil
 }
 
-func generateIndexHTML(posts []*Post) error {
-	latestPost := posts[len(posts)-1]
-	indexHTML, err := latestPost.processPostTemplate(true)
+func generateIndexHTML(src fs.FS, out Output, posts []*Post, config *Config, log *buildLog) error {
+	if len(posts) == 0 {
+		log.warnf("no published posts; index.html isn't written")
+		return nil
+	}
+
+	indexPost := *posts[len(posts)-1]
+	indexPost.OGImages = ogImages("", "", config.OG.Variants)
+	indexPost.OGImagePath = indexPost.OGImages[0].Path
+
+	indexHTML, err := indexPost.processPostTemplate(src, config, true)
 	if err != nil {
-		return err
+		return buildError(PhaseTemplate, "layouts/post.html", err)
 	}
 
-	path := filepath.Join("public", "index.html")
-	return os.WriteFile(path, []byte(formatHTML(*indexHTML)), 0644)
+	if err := out.WriteFile("index.html", []byte(formatHTML(*indexHTML))); err != nil {
+		return buildError(PhaseTemplate, "index.html", err)
+	}
+	log.page("index.html")
+	return nil
 }
 
-func copyStaticFiles() error {
-	return filepath.Walk("static", func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+// copyStaticFiles copies the site's static/ and the default static files
+// it doesn't override.
+func copyStaticFiles(src fs.FS, out Output, log *buildLog) error {
+	static, err := fs.Sub(src, "static")
+	if err != nil {
+		return err
+	}
+	if _, err := fs.Stat(static, "."); err == nil {
+		if err := copyStaticFS(static, out, log, nil); err != nil {
 			return err
 		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
 
-		relativePath, err := filepath.Rel("static", path)
-		if err != nil {
+	return copyStaticFS(defaultStatic(), out, log, func(name string) bool {
+		_, err := fs.Stat(static, name)
+		return err == nil
+	})
+}
+
+// copyStaticFS copies the files in static, except those skip reports.
+func copyStaticFS(static fs.FS, out Output, log *buildLog, skip func(name string) bool) error {
+	return fs.WalkDir(static, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
 			return err
 		}
-
-		targetPath := filepath.Join("public", relativePath)
-
-		if info.IsDir() {
-			return os.MkdirAll(targetPath, os.ModePerm)
+		if skip != nil && skip(name) {
+			return nil
 		}
 
-		input, err := os.ReadFile(path)
+		input, err := fs.ReadFile(static, name)
 		if err != nil {
-			return err
+			return buildError(PhaseCopy, name, err)
 		}
 
-		return os.WriteFile(targetPath, input, info.Mode())
+		if err := out.WriteFile(name, input); err != nil {
+			return buildError(PhaseCopy, name, err)
+		}
+		log.file(name)
+		return nil
 	})
 }
 
-func createPostObjects() ([]*Post, error) {
+func createPostObjects(src fs.FS) ([]*Post, error) {
 	var posts []*Post
 
-	files, err := os.ReadDir("posts")
+	files, err := fs.ReadDir(src, "posts")
 	if err != nil {
 		return nil, err
 	}
 
 	for _, file := range files {
-		post, err := createPostObject(file)
+		name := path.Join("posts", file.Name())
+		post, err := readPost(src, name)
 		if err != nil {
-			return nil, err
+			return nil, buildError(PhaseParse, name, err)
 		}
 		posts = append(posts, post)
 	}
@@ -177,47 +318,64 @@ func createPostObjects() ([]*Post, error) {
 	return posts, nil
 }
 
-func generateAtomXML(posts []*Post) error {
+// publishedPosts leaves out drafts.
+func publishedPosts(posts []*Post) []*Post {
+	var published []*Post
+	for _, post := range posts {
+		if !post.Draft {
+			published = append(published, post)
+		}
+	}
+	return published
+}
+
+func generateAtomXML(src fs.FS, out Output, posts []*Post, config *Config, log *buildLog) error {
+	posts = slices.Clone(posts)
 	sort.Slice(posts, func(i, j int) bool {
 		return posts[i].Date.After(posts[j].Date)
 	})
 
-	posts = posts[0:9]
+	posts = posts[:min(len(posts), 9)]
 
-	tmpl, err := template.New("atom.xml").Funcs(template.FuncMap{
-		"formatDate": formatDate,
-	}).ParseFiles("layouts/atom.xml")
+	layout := "layouts/atom.xml"
+	tmpl, err := parseLayout(src, "atom.xml", config)
 	if err != nil {
-		return err
+		return buildError(PhaseTemplate, layout, err)
 	}
 
 	var buf bytes.Buffer
 	err = tmpl.Execute(&buf, posts)
 	if err != nil {
-		return err
+		return buildError(PhaseTemplate, layout, err)
 	}
 
-	path := filepath.Join("public", "atom.xml")
-	return os.WriteFile(path, buf.Bytes(), 0644)
+	if err := out.WriteFile("atom.xml", buf.Bytes()); err != nil {
+		return buildError(PhaseTemplate, "atom.xml", err)
+	}
+	log.page("atom.xml")
+	return nil
 }
 
-func createPostObject(file os.DirEntry) (*Post, error) {
-	post := &Post{}
-
-	path := filepath.Join("posts", file.Name())
-
-	f, err := os.Open(path)
+// readPost reads the post name from src.
+func readPost(src fs.FS, name string) (*Post, error) {
+	f, err := src.Open(name)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
+	return parsePost(name, f)
+}
+
+func parsePost(path string, r io.Reader) (*Post, error) {
+	post := &Post{SourcePath: path}
+
 	inHeader := false
 	inBody := false
 
 	headerString := ""
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
 
@@ -251,40 +409,59 @@ func createPostObject(file os.DirEntry) (*Post, error) {
 	}
 
 	post.Title = header.Title
-	post.Date, _ = time.ParseInLocation("2006-01-02 15:04:05 +0900", header.Date, time.FixedZone("Asia/Tokyo", 9*60*60))
+	post.OGImage = header.OGImage
+	post.OGCover = header.OGCover
+	post.OGTitle = header.OGTitle
+	post.OGSubtitle = header.OGSubtitle
+	post.Summary = header.Summary
+	post.Tags = header.Tags
+	post.Date = parsePostDate(header.Date)
+	post.Draft = header.Draft
+	post.Aliases = header.Aliases
+
+	prose := countProse(post.RawContent)
+	post.WordCount = prose.Words()
+	post.ReadingTime = prose.ReadingMinutes()
 
-	if post.Date.IsZero() {
-		post.Date, _ = time.ParseInLocation("2006-01-02 15:04:05", header.Date, time.FixedZone("Asia/Tokyo", 9*60*60))
-	}
+	return post, nil
+}
 
-	if post.Date.IsZero() {
-		post.Date, _ = time.ParseInLocation("2006-01-02 15:04", header.Date, time.FixedZone("Asia/Tokyo", 9*60*60))
-	}
+// Post dates are written and read in Japan time.
+var postLocation = time.FixedZone("Asia/Tokyo", 9*60*60)
 
-	return post, nil
+// parsePostDate parses the date in front matter, returning the zero time
+// if it's in none of the accepted formats.
+func parsePostDate(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05 +0900", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, postLocation); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
 }
 
-func (p *Post) convertMarkdown() error {
-	md := goldmark.New(
+func newMarkdown(config *Config, siteLexers lexerSet, linkCards *linkCardCache) goldmark.Markdown {
+	return goldmark.New(
 		goldmark.WithExtensions(
 			extension.GFM,
-			highlighting.NewHighlighting(
-				highlighting.WithStyle("nord"),
-				highlighting.WithFormatOptions(
-					html.WithClasses(true),
-				),
-			),
+			&codeBlockExtension{
+				lineNumbers: config.Highlight.LineNumbers,
+				lexers:      siteLexers,
+			},
 			&mermaid.Extender{
 				RenderMode: mermaid.RenderModeClient,
 				NoScript:   true,
 			},
+			&linkCardExtension{cache: linkCards},
 		),
 		goldmark.WithRendererOptions(
 			gmhtml.WithHardWraps(),
 			gmhtml.WithXHTML(),
 			gmhtml.WithUnsafe(),
 		))
+}
 
+func (p *Post) convertMarkdown(md goldmark.Markdown) error {
 	var buf bytes.Buffer
 	err := md.Convert([]byte(p.RawContent), &buf)
 	if err != nil {
@@ -296,8 +473,8 @@ func (p *Post) convertMarkdown() error {
 	return nil
 }
 
-func (p *Post) processLayout() error {
-	content, err := p.processPostTemplate(false)
+func (p *Post) processLayout(src fs.FS, config *Config) error {
+	content, err := p.processPostTemplate(src, config, false)
 	if err != nil {
 		return err
 	}
@@ -307,12 +484,10 @@ func (p *Post) processLayout() error {
 	return nil
 }
 
-func (p *Post) processPostTemplate(index bool) (*string, error) {
+func (p *Post) processPostTemplate(src fs.FS, config *Config, index bool) (*string, error) {
 	p.Index = index
 
-	tmpl, err := template.New("post.html").Funcs(template.FuncMap{
-		"formatDate": formatDate,
-	}).ParseFiles("layouts/post.html")
+	tmpl, err := parseLayout(src, "post.html", config)
 	if err != nil {
 		return nil, err
 	}
@@ -9,14 +9,13 @@ require (
 	github.com/goccy/go-yaml v1.15.15
 	github.com/yosssi/gohtml v0.0.0-20201013000340-ee4748c638f4
 	github.com/yuin/goldmark v1.7.13
-	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
 	go.abhg.dev/goldmark/mermaid v0.6.0
 	golang.org/x/image v0.35.0
+	golang.org/x/net v0.34.0
+	golang.org/x/text v0.33.0
 )
 
 require (
 	github.com/dlclark/regexp2 v1.11.5 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
-	golang.org/x/net v0.34.0 // indirect
-	golang.org/x/text v0.33.0 // indirect
 )
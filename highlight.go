@@ -0,0 +1,253 @@
+package nebel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+const lexersDir = "lexers"
+
+// customLexers are the lexers nebel adds to Chroma's registry.
+var customLexers lexerSet
+
+// registerCustomLexer adds lexer to Chroma's registry, replacing any
+// lexer registered earlier under the same name.
+func registerCustomLexer(lexer chroma.Lexer) {
+	lexers.Register(lexer)
+	customLexers = customLexers.with(lexer)
+}
+
+// lexerSet is a list of lexers with unique names.
+type lexerSet []chroma.Lexer
+
+// with returns the set with lexer added, replacing the one of the same
+// name.
+func (s lexerSet) with(lexer chroma.Lexer) lexerSet {
+	for i, l := range s {
+		if l.Config().Name == lexer.Config().Name {
+			s[i] = lexer
+			return s
+		}
+	}
+	return append(s, lexer)
+}
+
+// get returns the lexer in the set whose name or alias is lang, or else
+// Chroma's lexer for it, or nil.
+func (s lexerSet) get(lang string) chroma.Lexer {
+	for _, lexer := range s {
+		config := lexer.Config()
+		if strings.EqualFold(config.Name, lang) || slices.ContainsFunc(config.Aliases, func(alias string) bool {
+			return strings.EqualFold(alias, lang)
+		}) {
+			return lexer
+		}
+	}
+	return lexers.Get(lang)
+}
+
+// loadSiteLexers reads the Chroma XML lexer definitions found in the
+// site's lexers/ directory. They aren't registered with Chroma, so they
+// only apply to this site, where they override built-in lexers of the same
+// name.
+func loadSiteLexers(src fs.FS) (lexerSet, error) {
+	files, err := fs.ReadDir(src, lexersDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var set lexerSet
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".xml" {
+			continue
+		}
+
+		name := path.Join(lexersDir, file.Name())
+		lexer, err := chroma.NewXMLLexer(src, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		set = set.with(lexer)
+	}
+
+	return set, nil
+}
+
+// generateChromaCSS writes the stylesheet for highlighted code, using the
+// light style by default and the dark style under prefers-color-scheme.
+func generateChromaCSS(out Output, config *Config, siteLexers lexerSet, log *buildLog) error {
+	light, err := chromaStyle(config.Highlight.LightStyle)
+	if err != nil {
+		return err
+	}
+
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+
+	var buf bytes.Buffer
+	buf.WriteString("/* Generated by nebel. Do not edit. */\n")
+	fmt.Fprintf(&buf, "\n/* Chroma %q style */\n", light.Name)
+	if err := formatter.WriteCSS(&buf, light); err != nil {
+		return err
+	}
+	writeCodeBlockCSS(&buf, light)
+	// The site's lexers are checked along with nebel's, which they override
+	checked := slices.Clone(customLexers)
+	for _, lexer := range siteLexers {
+		checked = checked.with(lexer)
+	}
+
+	for _, w := range uncoveredTokenTypes(light, checked) {
+		log.warnf("%s", w)
+	}
+
+	if config.Highlight.DarkStyle != "" {
+		dark, err := chromaStyle(config.Highlight.DarkStyle)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&buf, "\n/* Chroma %q style */\n@media (prefers-color-scheme: dark) {\n", dark.Name)
+		if err := formatter.WriteCSS(&buf, dark); err != nil {
+			return err
+		}
+		writeCodeBlockCSS(&buf, dark)
+		buf.WriteString("}\n")
+		for _, w := range uncoveredTokenTypes(dark, checked) {
+			log.warnf("%s", w)
+		}
+	}
+
+	if err := out.WriteFile("css/chroma.css", buf.Bytes()); err != nil {
+		return buildError(PhaseCopy, "css/chroma.css", err)
+	}
+	log.file("css/chroma.css")
+	return nil
+}
+
+func chromaStyle(name string) (*chroma.Style, error) {
+	style, ok := styles.Registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown highlight style %q", name)
+	}
+	return style, nil
+}
+
+// writeCodeBlockCSS adds the rules for the markup codeBlockExtension puts
+// around Chroma's output, taking the diff colors from the style.
+func writeCodeBlockCSS(buf *bytes.Buffer, style *chroma.Style) {
+	inserted := style.Get(chroma.GenericInserted).Colour
+	if !inserted.IsSet() {
+		inserted = chroma.NewColour(0x22, 0x86, 0x3a)
+	}
+	deleted := style.Get(chroma.GenericDeleted).Colour
+	if !deleted.IsSet() {
+		deleted = chroma.NewColour(0xcb, 0x24, 0x31)
+	}
+
+	fmt.Fprintf(buf, ".chroma .line.diff-add { background-color: rgba(%d, %d, %d, 0.15) }\n", inserted.Red(), inserted.Green(), inserted.Blue())
+	fmt.Fprintf(buf, ".chroma .line.diff-del { background-color: rgba(%d, %d, %d, 0.15) }\n", deleted.Red(), deleted.Green(), deleted.Blue())
+}
+
+// uncoveredTokenTypes warns about token types emitted by custom lexers
+// that the style renders the same as plain text. Names colored like Name
+// itself, such as variables in most styles, are plain on purpose and aren't
+// reported.
+func uncoveredTokenTypes(style *chroma.Style, custom lexerSet) []string {
+	text := style.Get(chroma.Text)
+
+	var warnings []string
+	for _, lexer := range custom {
+		for _, tt := range lexerTokenTypes(lexer) {
+			if tt.InCategory(chroma.Text) || tt.InCategory(chroma.Punctuation) {
+				continue
+			}
+			if tt.InCategory(chroma.Name) && style.Get(tt).Colour == style.Get(chroma.Name).Colour {
+				continue
+			}
+			if style.Get(tt).Sub(text).IsZero() {
+				warnings = append(warnings, fmt.Sprintf("%s style has no color for %s tokens of the %s lexer", style.Name, tt, lexer.Config().Name))
+			}
+		}
+	}
+	return warnings
+}
+
+func lexerTokenTypes(lexer chroma.Lexer) []chroma.TokenType {
+	regexLexer, ok := lexer.(*chroma.RegexLexer)
+	if !ok {
+		return nil
+	}
+
+	rules, err := regexLexer.Rules()
+	if err != nil {
+		return nil
+	}
+
+	seen := map[chroma.TokenType]bool{}
+	var types []chroma.TokenType
+	for _, state := range rules {
+		for _, rule := range state {
+			for _, tt := range emittedTokenTypes(rule.Type) {
+				if !seen[tt] {
+					seen[tt] = true
+					types = append(types, tt)
+				}
+			}
+		}
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i] < types[j]
+	})
+
+	return types
+}
+
+// emittedTokenTypes returns the token types an emitter emits directly or
+// through ByGroups. Chroma doesn't export the emitters ByGroups holds, so
+// they're read from its Emitters field.
+func emittedTokenTypes(emitter chroma.Emitter) []chroma.TokenType {
+	if tt, ok := emitter.(chroma.TokenType); ok {
+		return []chroma.TokenType{tt}
+	}
+
+	v := reflect.ValueOf(emitter)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	field := v.FieldByName("Emitters")
+	if !field.IsValid() {
+		return nil
+	}
+	emitters, ok := field.Interface().(chroma.Emitters)
+	if !ok {
+		return nil
+	}
+
+	var types []chroma.TokenType
+	for _, e := range emitters {
+		types = append(types, emittedTokenTypes(e)...)
+	}
+	return types
+}
@@ -0,0 +1,58 @@
+package nebel
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+func TestEmittedTokenTypes(t *testing.T) {
+	emitter := chroma.ByGroups(chroma.Keyword, chroma.Text, chroma.ByGroups(chroma.NameClass, chroma.UsingSelf("root")))
+	got := emittedTokenTypes(emitter)
+	want := []chroma.TokenType{chroma.Keyword, chroma.Text, chroma.NameClass}
+	if !slices.Equal(got, want) {
+		t.Errorf("emittedTokenTypes() = %v, want %v", got, want)
+	}
+}
+
+func TestLexerTokenTypes(t *testing.T) {
+	lexer := chroma.MustNewLexer(&chroma.Config{Name: "test"}, func() chroma.Rules {
+		return chroma.Rules{
+			"root": {
+				{Pattern: `(type)(\s+)(\w+)`, Type: chroma.ByGroups(chroma.Keyword, chroma.Text, chroma.NameClass)},
+				{Pattern: `\d+`, Type: chroma.NumberInteger},
+				{Pattern: `\s+`, Type: chroma.Text},
+			},
+		}
+	})
+
+	got := lexerTokenTypes(lexer)
+	want := []chroma.TokenType{chroma.Keyword, chroma.NameClass, chroma.NumberInteger, chroma.Text}
+	if !slices.Equal(got, want) {
+		t.Errorf("lexerTokenTypes() = %v, want %v", got, want)
+	}
+}
+
+func TestUncoveredTokenTypes(t *testing.T) {
+	// Plain variables are on purpose, so the bundled styles are clean
+	for _, name := range []string{"github", "nord", "monokai"} {
+		if warnings := uncoveredTokenTypes(styles.Get(name), customLexers); len(warnings) > 0 {
+			t.Errorf("%s: %q", name, warnings)
+		}
+	}
+
+	style, err := chroma.NewStyle("plain", chroma.StyleEntries{
+		chroma.Background: "#000000 bg:#ffffff",
+		chroma.Comment:    "#888888",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := uncoveredTokenTypes(style, customLexers)
+	if !slices.Contains(warnings, "plain style has no color for Keyword tokens of the Carina lexer") {
+		t.Errorf("warnings = %q, want Carina keywords", warnings)
+	}
+
+}
@@ -0,0 +1,350 @@
+package nebel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// htmlToMarkdown converts the HTML body of an imported post to Markdown.
+// image maps each image URL to the one to link to. Elements Markdown has no
+// syntax for, such as tables and embeds, are kept as HTML, which the
+// renderer passes through.
+func htmlToMarkdown(src string, image func(string) string) (string, error) {
+	body := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(src), body)
+	if err != nil {
+		return "", err
+	}
+
+	c := &mdConverter{image: image}
+	return c.blocks(nodes) + "\n", nil
+}
+
+type mdConverter struct {
+	image func(string) string
+}
+
+// Elements that start a new block in Markdown
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Ul: true, atom.Ol: true,
+	atom.Li: true, atom.Blockquote: true, atom.Pre: true, atom.Hr: true,
+	atom.Table: true, atom.Figure: true, atom.Figcaption: true, atom.Section: true,
+	atom.Article: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Nav: true, atom.Iframe: true, atom.Script: true, atom.Style: true,
+	atom.Dl: true, atom.Video: true, atom.Audio: true, atom.Details: true,
+	atom.Center: true, atom.Address: true, atom.Object: true, atom.Embed: true,
+}
+
+func isBlock(n *xhtml.Node) bool {
+	return n.Type == xhtml.ElementNode && blockElements[n.DataAtom]
+}
+
+// blocks converts sibling nodes into blocks separated by blank lines,
+// gathering runs of inline content into paragraphs.
+func (c *mdConverter) blocks(nodes []*xhtml.Node) string {
+	var out []string
+	var inline []*xhtml.Node
+
+	flush := func() {
+		if p := c.paragraph(inline); p != "" {
+			out = append(out, p)
+		}
+		inline = nil
+	}
+
+	for _, n := range nodes {
+		if n.Type == xhtml.CommentNode {
+			continue
+		}
+		if !isBlock(n) {
+			inline = append(inline, n)
+			continue
+		}
+		flush()
+		if b := c.block(n); b != "" {
+			out = append(out, b)
+		}
+	}
+	flush()
+
+	return strings.Join(out, "\n\n")
+}
+
+func (c *mdConverter) block(n *xhtml.Node) string {
+	switch n.DataAtom {
+	case atom.P, atom.Figcaption:
+		return c.paragraph(children(n))
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := strings.ReplaceAll(c.paragraph(children(n)), "\n", " ")
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + text
+	case atom.Ul, atom.Ol:
+		return c.list(n)
+	case atom.Li:
+		return c.blocks(children(n))
+	case atom.Blockquote:
+		return prefixLines(c.blocks(children(n)), "> ", ">")
+	case atom.Pre:
+		return codeFence(n)
+	case atom.Hr:
+		return "---"
+	case atom.Div, atom.Figure, atom.Section, atom.Article, atom.Header,
+		atom.Footer, atom.Aside, atom.Nav, atom.Center, atom.Address:
+		return c.blocks(children(n))
+	}
+	return renderHTML(n)
+}
+
+func (c *mdConverter) list(n *xhtml.Node) string {
+	var items []string
+	num := 1
+	for _, li := range children(n) {
+		if li.Type != xhtml.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", num)
+			num++
+		}
+
+		// Later lines of an item are indented to its content
+		content := c.blocks(children(li))
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, marker+strings.TrimPrefix(prefixLines(content, indent, ""), indent))
+	}
+	return strings.Join(items, "\n")
+}
+
+// paragraph converts inline nodes, keeping line breaks from <br>.
+func (c *mdConverter) paragraph(nodes []*xhtml.Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		c.inline(&b, n)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+var collapseSpace = regexp.MustCompile(`\s+`)
+
+func (c *mdConverter) inline(b *strings.Builder, n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		b.WriteString(escapeMarkdown(collapseSpace.ReplaceAllString(n.Data, " ")))
+		return
+	case xhtml.ElementNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		// Newlines are hard line breaks in nebel's Markdown
+		b.WriteString("\n")
+	case atom.Strong, atom.B:
+		b.WriteString(c.wrap(n, "**"))
+	case atom.Em, atom.I:
+		b.WriteString(c.wrap(n, "*"))
+	case atom.Del, atom.S, atom.Strike:
+		b.WriteString(c.wrap(n, "~~"))
+	case atom.Code, atom.Tt, atom.Kbd:
+		b.WriteString(inlineCode(textContent(n)))
+	case atom.A:
+		href := attr(n, "href")
+		text := c.inlineText(n)
+		if href == "" || text == "" {
+			b.WriteString(text)
+			return
+		}
+		fmt.Fprintf(b, "[%s](%s)", text, markdownURL(href))
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" {
+			return
+		}
+		fmt.Fprintf(b, "![%s](%s)", escapeMarkdown(attr(n, "alt")), markdownURL(c.image(src)))
+	case atom.Script, atom.Style:
+	default:
+		if isBlock(n) {
+			// A block inside inline content, such as an embed in a <p>
+			b.WriteString(renderHTML(n))
+			return
+		}
+		for _, child := range children(n) {
+			c.inline(b, child)
+		}
+	}
+}
+
+func (c *mdConverter) inlineText(n *xhtml.Node) string {
+	var b strings.Builder
+	for _, child := range children(n) {
+		c.inline(&b, child)
+	}
+	return b.String()
+}
+
+// wrap puts marker around the content of n, moving the spaces at its ends
+// outside, where emphasis allows them.
+func (c *mdConverter) wrap(n *xhtml.Node, marker string) string {
+	text := c.inlineText(n)
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// codeFence converts a <pre> into a fenced code block, taking the language
+// from a language-* or lang-* class on it or its <code>, or from Hatena's
+// data-lang.
+func codeFence(pre *xhtml.Node) string {
+	lang := attr(pre, "data-lang")
+	for _, n := range append([]*xhtml.Node{pre}, children(pre)...) {
+		for _, class := range strings.Fields(attr(n, "class")) {
+			for _, prefix := range []string{"language-", "lang-"} {
+				if strings.HasPrefix(class, prefix) && lang == "" {
+					lang = strings.TrimPrefix(class, prefix)
+				}
+			}
+		}
+	}
+
+	code := strings.TrimRight(textContent(pre), "\n")
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+func inlineCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	delim := "`"
+	for strings.Contains(s, delim) {
+		delim += "`"
+	}
+	if len(delim) > 1 || strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return delim + " " + s + " " + delim
+	}
+	return delim + s + delim
+}
+
+var markdownSpecial = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`,
+)
+
+func escapeMarkdown(s string) string {
+	return markdownSpecial.Replace(s)
+}
+
+// markdownURL wraps a URL in angle brackets if it would end the link early.
+func markdownURL(u string) string {
+	if strings.ContainsAny(u, " ()") {
+		return "<" + u + ">"
+	}
+	return u
+}
+
+// prefixLines prefixes each line of s, using empty for blank lines.
+func prefixLines(s, prefix, empty string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = empty
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func children(n *xhtml.Node) []*xhtml.Node {
+	var nodes []*xhtml.Node
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, child)
+	}
+	return nodes
+}
+
+func textContent(n *xhtml.Node) string {
+	if n.Type == xhtml.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func attr(n *xhtml.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func renderHTML(n *xhtml.Node) string {
+	var b strings.Builder
+	if err := xhtml.Render(&b, n); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+var (
+	preBlock      = regexp.MustCompile(`(?is)<pre[\s>].*?</pre>`)
+	blockTagStart = regexp.MustCompile(`(?i)^<(p|div|h[1-6]|ul|ol|li|blockquote|pre|table|figure|hr|iframe|script|section|dl)[\s>/]`)
+)
+
+// autoParagraph wraps blank-line separated text in <p> and turns the other
+// newlines into <br />, as Movable Type and WordPress do when publishing.
+// Text already in a block element and <pre> contents are left alone.
+func autoParagraph(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	var pres []string
+	s = preBlock.ReplaceAllStringFunc(s, func(pre string) string {
+		pres = append(pres, pre)
+		return fmt.Sprintf("\x00%d\x00", len(pres)-1)
+	})
+
+	var out []string
+	for _, chunk := range regexp.MustCompile(`\n\s*\n`).Split(s, -1) {
+		chunk = strings.TrimSpace(chunk)
+		switch {
+		case chunk == "":
+		case blockTagStart.MatchString(chunk), strings.HasPrefix(chunk, "\x00"):
+			out = append(out, chunk)
+		default:
+			out = append(out, "<p>"+strings.ReplaceAll(chunk, "\n", "<br />\n")+"</p>")
+		}
+	}
+
+	s = strings.Join(out, "\n\n")
+	for i, pre := range pres {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), pre, 1)
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package nebel
+
+import "testing"
+
+func TestHTMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"paragraphs", "<p>One</p><p>Two</p>", "One\n\nTwo\n"},
+		{"bare text", "Hello <b>world</b>", "Hello **world**\n"},
+		{"line breaks", "<p>a<br>b<br/>c</p>", "a\nb\nc\n"},
+		{"emphasis spaces", "<p>a<em> b </em>c</p>", "a *b* c\n"},
+		{"headings", "<h2>Title <i>here</i></h2><p>text</p>", "## Title *here*\n\ntext\n"},
+		{"empty heading", "<h3> </h3>", "\n"},
+		{"link", `<a href="https://example.com/a b">x</a>`, "[x](<https://example.com/a b>)\n"},
+		{"link without href", "<a>x</a>", "x\n"},
+		{"image", `<img src="/a.png" alt="A*">`, "![A\\*](/img/a.png)\n"},
+		{"escapes", "<p>a_b *c* [d]</p>", "a\\_b \\*c\\* \\[d\\]\n"},
+		{"inline code", "<code>a`b</code>", "`` a`b ``\n"},
+		{"unordered list", "<ul><li>a</li><li>b</li></ul>", "- a\n- b\n"},
+		{"ordered list", "<ol><li>a</li><li><p>b</p><p>c</p></li></ol>", "1. a\n2. b\n\n   c\n"},
+		{"blockquote", "<blockquote><p>a</p><p>b</p></blockquote>", "> a\n>\n> b\n"},
+		{"code block", `<pre class="language-go"><code>x := 1
+</code></pre>`, "```go\nx := 1\n```\n"},
+		{"hatena code block", "<pre data-lang=\"sh\">echo ```</pre>", "````sh\necho ```\n````\n"},
+		{"horizontal rule", "<p>a</p><hr><p>b</p>", "a\n\n---\n\nb\n"},
+		{"table kept as html", "<table><tr><td>a</td></tr></table>", "<table><tbody><tr><td>a</td></tr></tbody></table>\n"},
+		{"embed in paragraph", `<p>see <iframe src="x"></iframe></p>`, "see <iframe src=\"x\"></iframe>\n"},
+		{"comments and scripts dropped", "<!-- c --><p>a<script>x()</script></p>", "a\n"},
+		{"div unwrapped", "<div><p>a</p><div>b</div></div>", "a\n\nb\n"},
+	}
+
+	image := func(src string) string { return "/img" + src }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := htmlToMarkdown(tt.html, image)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("htmlToMarkdown(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutoParagraph(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"single line", "Hello", "<p>Hello</p>"},
+		{"paragraphs", "a\n\nb", "<p>a</p>\n\n<p>b</p>"},
+		{"line breaks", "a\nb", "<p>a<br />\nb</p>"},
+		{"crlf", "a\r\nb\r\n\r\nc", "<p>a<br />\nb</p>\n\n<p>c</p>"},
+		{"blank lines with spaces", "a\n  \n\nb", "<p>a</p>\n\n<p>b</p>"},
+		{"block elements", "<h2>T</h2>\n\n<ul>\n<li>a</li>\n</ul>", "<h2>T</h2>\n\n<ul>\n<li>a</li>\n</ul>"},
+		{"pre", "a\n\n<pre>x\n\ny</pre>\n\nb", "<p>a</p>\n\n<pre>x\n\ny</pre>\n\n<p>b</p>"},
+		{"inline html", "<b>a</b>\nb", "<p><b>a</b><br />\nb</p>"},
+		{"empty", "\n\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := autoParagraph(tt.in); got != tt.want {
+				t.Errorf("autoParagraph(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
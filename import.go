@@ -0,0 +1,215 @@
+package nebel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// ImportOptions control how posts are imported.
+type ImportOptions struct {
+	// From is the export format, "mt" (Movable Type and Hatena Blog) or
+	// "wxr" (WordPress).
+	From string
+	// Images is a local directory holding the images the posts reference.
+	// Images found there are copied to static/images/<post>/; the others
+	// keep their original URLs.
+	Images string
+	// AliasPrefix is prepended to a Movable Type BASENAME to make the old
+	// URL path, e.g. "/entry/" for Hatena Blog.
+	AliasPrefix string
+}
+
+// importedEntry is a post read from an export, with an HTML body.
+type importedEntry struct {
+	Title   string
+	Date    time.Time
+	Slug    string
+	Tags    []string
+	Draft   bool
+	Aliases []string
+	Body    string
+}
+
+// importedHeader is the front matter written for an imported post.
+type importedHeader struct {
+	Title   string   `yaml:"title"`
+	Date    string   `yaml:"date"`
+	Tags    []string `yaml:"tags,omitempty"`
+	Draft   bool     `yaml:"draft,omitempty"`
+	Aliases []string `yaml:"aliases,omitempty"`
+}
+
+// ImportPosts converts the entries of an export file into posts in the
+// site's Dir. Posts whose file already exists are skipped, so an import
+// can be rerun.
+func (s *Site) ImportPosts(file string, opts ImportOptions) error {
+	if s.Dir == "" {
+		return errors.New("the site has no directory to import posts to")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var entries []importedEntry
+	switch opts.From {
+	case "mt":
+		entries, err = parseMT(f, opts.AliasPrefix)
+	case "wxr":
+		entries, err = parseWXR(f)
+	default:
+		return fmt.Errorf("unknown import format %q", opts.From)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	imported, skipped := 0, 0
+	used := map[string]bool{}
+	for _, entry := range entries {
+		name := importFileName(entry, used)
+		path := filepath.Join(s.Dir, "posts", name+".markdown")
+
+		ok, err := writeImportedPost(path, name, entry, opts.Images, s.Dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if ok {
+			imported++
+		} else {
+			fmt.Fprintf(os.Stderr, "skipped %s: already exists\n", path)
+			skipped++
+		}
+	}
+
+	fmt.Printf("imported %d posts, skipped %d\n", imported, skipped)
+	return nil
+}
+
+// importFileName is <date>-<slug>, from the title or else the entry's own
+// slug, numbered when two entries of a day share it.
+func importFileName(entry importedEntry, used map[string]bool) string {
+	slug := slugify(entry.Title)
+	if slug == "" {
+		slug = slugify(path.Base(entry.Slug))
+	}
+	if slug == "" {
+		slug = "entry"
+	}
+
+	base := entry.Date.Format("2006-01-02") + "-" + slug
+	name := base
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	used[name] = true
+	return name
+}
+
+// writeImportedPost writes entry to path, copying its images into the
+// site in siteDir, and returns false if the file already exists.
+func writeImportedPost(path, name string, entry importedEntry, imagesDir, siteDir string) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	}
+
+	body, err := htmlToMarkdown(entry.Body, func(src string) string {
+		return importImage(src, imagesDir, siteDir, name)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	header, err := yaml.Marshal(importedHeader{
+		Title:   entry.Title,
+		Date:    entry.Date.In(postLocation).Format("2006-01-02 15:04:05 +0900"),
+		Tags:    entry.Tags,
+		Draft:   entry.Draft,
+		Aliases: entry.Aliases,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	content := "---\n" + string(header) + "---\n\n" + body
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// importImage copies the image src refers to from imagesDir into
+// static/images/<name>/ of the site in siteDir and returns its new URL. The image is looked up by
+// its host and path, its path, then its file name, so both a mirrored
+// tree and a flat directory of downloads work.
+func importImage(src, imagesDir, siteDir, name string) string {
+	if imagesDir == "" {
+		return src
+	}
+
+	u, err := url.Parse(src)
+	if err != nil || u.Path == "" {
+		return src
+	}
+
+	candidates := []string{
+		filepath.Join(imagesDir, u.Host, filepath.FromSlash(u.Path)),
+		filepath.Join(imagesDir, filepath.FromSlash(u.Path)),
+		filepath.Join(imagesDir, path.Base(u.Path)),
+	}
+	for _, candidate := range candidates {
+		if err := copyImportedImage(candidate, filepath.Join(siteDir, "static", "images", name), path.Base(u.Path)); err == nil {
+			return "/images/" + name + "/" + path.Base(u.Path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", candidate, err)
+			return src
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: image not found in %s\n", src, imagesDir)
+	return src
+}
+
+func copyImportedImage(from, dir, file string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if info, err := in.Stat(); err != nil || info.IsDir() {
+		return os.ErrNotExist
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	out, err := os.Create(filepath.Join(dir, file))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
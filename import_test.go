@@ -0,0 +1,56 @@
+package nebel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMTExport = `TITLE: Hello
+BASENAME: 2024/01/02/hello
+STATUS: Publish
+DATE: 01/02/2024 10:00:00
+-----
+BODY:
+<p>Hi <img src="https://example.com/photo.png"></p>
+-----
+--------
+`
+
+func TestImportPosts(t *testing.T) {
+	dir := t.TempDir()
+	images := t.TempDir()
+	export := filepath.Join(t.TempDir(), "export.txt")
+	if err := os.WriteFile(export, []byte(testMTExport), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(images, "photo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "posts"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	site := NewSite(dir)
+	if err := site.ImportPosts(export, ImportOptions{From: "mt", Images: images, AliasPrefix: "/entry/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := os.ReadFile(filepath.Join(dir, "posts", "2024-01-02-hello.markdown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"title: Hello", "/entry/2024/01/02/hello", "![](/images/2024-01-02-hello/photo.png)"} {
+		if !strings.Contains(string(post), want) {
+			t.Errorf("imported post lacks %q:\n%s", want, post)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "static", "images", "2024-01-02-hello", "photo.png")); err != nil {
+		t.Errorf("image wasn't copied into the site: %v", err)
+	}
+
+	if err := (&Site{Source: testSite(0), Output: MemoryOutput{}}).ImportPosts(export, ImportOptions{From: "mt"}); err == nil {
+		t.Error("ImportPosts() succeeded for a site without a directory")
+	}
+}
@@ -0,0 +1,81 @@
+package nebel
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+)
+
+type wxrFile struct {
+	Items []wxrItem `xml:"channel>item"`
+}
+
+// wxrItem is a WordPress export item. Element names match in any version
+// of the wp namespace.
+type wxrItem struct {
+	Title      string        `xml:"title"`
+	Link       string        `xml:"link"`
+	Content    string        `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostName   string        `xml:"post_name"`
+	PostDate   string        `xml:"post_date"`
+	Status     string        `xml:"status"`
+	PostType   string        `xml:"post_type"`
+	Categories []wxrCategory `xml:"category"`
+}
+
+type wxrCategory struct {
+	Domain   string `xml:"domain,attr"`
+	Nicename string `xml:"nicename,attr"`
+	Name     string `xml:",chardata"`
+}
+
+// parseWXR reads the posts in a WordPress eXtended RSS export, leaving out
+// pages, attachments and menu items. Each post's old URL path becomes an
+// alias.
+func parseWXR(r io.Reader) ([]importedEntry, error) {
+	var file wxrFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	var entries []importedEntry
+	for _, item := range file.Items {
+		if item.PostType != "post" {
+			continue
+		}
+
+		date, err := time.ParseInLocation("2006-01-02 15:04:05", item.PostDate, postLocation)
+		if err != nil {
+			return nil, fmt.Errorf("%q: invalid post_date %q", item.Title, item.PostDate)
+		}
+
+		entry := importedEntry{
+			Title: item.Title,
+			Date:  date,
+			Slug:  item.PostName,
+			Draft: item.Status != "publish",
+			// WordPress stores posts before wpautop
+			Body: autoParagraph(item.Content),
+		}
+		if slug, err := url.PathUnescape(item.PostName); err == nil {
+			entry.Slug = slug
+		}
+
+		for _, c := range item.Categories {
+			if c.Nicename == "uncategorized" || c.Name == "" || slices.Contains(entry.Tags, c.Name) {
+				continue
+			}
+			entry.Tags = append(entry.Tags, c.Name)
+		}
+
+		if u, err := url.Parse(item.Link); err == nil && u.Path != "" && u.Path != "/" {
+			entry.Aliases = append(entry.Aliases, u.Path)
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
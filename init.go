@@ -0,0 +1,108 @@
+package nebel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// InitOptions are the optional settings of a new site.
+type InitOptions struct {
+	// Title is the site name; the directory name when empty.
+	Title string
+}
+
+// samplePost is the default post written, dated today, to a new site.
+const samplePost = "posts/welcome.markdown"
+
+// InitSite creates a site in dir from the defaults: config.yaml, the
+// layouts, static files and archetypes, and a sample post. It refuses to
+// touch a directory that already has config.yaml or posts/.
+func InitSite(dir string, opts InitOptions) error {
+	for _, name := range []string{configPath, "posts"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return fmt.Errorf("%s already has %s", dir, name)
+		}
+	}
+
+	title := opts.Title
+	if title == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		title = filepath.Base(abs)
+	}
+
+	date := time.Now().In(postLocation)
+	data := struct {
+		Title string
+		Date  string
+	}{title, date.Format("2006-01-02 15:04:05 +0900")}
+
+	return fs.WalkDir(defaultSite, "defaults", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := defaultSite.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		rel := name[len("defaults/"):]
+		if rel == configPath || rel == samplePost {
+			if content, err = executeInitTemplate(rel, content, data); err != nil {
+				return err
+			}
+		}
+		if rel == samplePost {
+			rel = path.Join("posts", date.Format("2006-01-02")+"-welcome-to-nebel.markdown")
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			fmt.Fprintf(os.Stderr, "skipped %s: already exists\n", target)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(content); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		fmt.Println(target)
+		return nil
+	})
+}
+
+// executeInitTemplate fills in the site title and date of config.yaml and
+// the sample post.
+func executeInitTemplate(name string, content []byte, data any) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"quote": quoteYAML}).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,160 @@
+package nebel
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// schema.org types used in JSON-LD. Empty fields are left out.
+
+type ldThing struct {
+	Context string `json:"@context,omitempty"`
+	Type    string `json:"@type"`
+}
+
+type ldPerson struct {
+	ldThing
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type ldImage struct {
+	ldThing
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+type ldOrganization struct {
+	ldThing
+	Name string   `json:"name"`
+	URL  string   `json:"url,omitempty"`
+	Logo *ldImage `json:"logo,omitempty"`
+}
+
+type ldBlogPosting struct {
+	ldThing
+	Headline         string          `json:"headline"`
+	Description      string          `json:"description,omitempty"`
+	URL              string          `json:"url"`
+	MainEntityOfPage string          `json:"mainEntityOfPage"`
+	DatePublished    string          `json:"datePublished"`
+	DateModified     string          `json:"dateModified"`
+	Author           *ldPerson       `json:"author,omitempty"`
+	Publisher        *ldOrganization `json:"publisher,omitempty"`
+	Image            []string        `json:"image,omitempty"`
+	Keywords         string          `json:"keywords,omitempty"`
+}
+
+type ldListItem struct {
+	ldThing
+	Position int    `json:"position"`
+	Name     string `json:"name"`
+	Item     string `json:"item"`
+}
+
+type ldBreadcrumbList struct {
+	ldThing
+	ItemListElement []ldListItem `json:"itemListElement"`
+}
+
+type ldWebSite struct {
+	ldThing
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	URL         string          `json:"url"`
+	Author      *ldPerson       `json:"author,omitempty"`
+	Publisher   *ldOrganization `json:"publisher,omitempty"`
+}
+
+const schemaContext = "https://schema.org"
+
+// jsonLD renders JSON-LD script tags: BlogPosting and BreadcrumbList for a
+// post, WebSite for the index.
+func jsonLD(config *Config, p *Post) (string, error) {
+	if p.Index {
+		return ldScripts(ldWebSite{
+			ldThing:     ldThing{schemaContext, "WebSite"},
+			Name:        config.siteName(),
+			Description: config.Description,
+			URL:         config.absURL("/"),
+			Author:      ldAuthor(config),
+			Publisher:   ldPublisher(config),
+		})
+	}
+
+	url := config.absURL(p.Path + "/")
+	posting := ldBlogPosting{
+		ldThing:          ldThing{schemaContext, "BlogPosting"},
+		Headline:         p.Title,
+		Description:      p.Summary,
+		URL:              url,
+		MainEntityOfPage: url,
+		DatePublished:    p.Date.Format(time.RFC3339),
+		DateModified:     p.Date.Format(time.RFC3339),
+		Author:           ldAuthor(config),
+		Publisher:        ldPublisher(config),
+		Keywords:         strings.Join(p.Tags, ", "),
+	}
+	for _, img := range p.OGImages {
+		posting.Image = append(posting.Image, config.absURL(img.Path))
+	}
+
+	breadcrumbs := ldBreadcrumbList{
+		ldThing: ldThing{schemaContext, "BreadcrumbList"},
+		ItemListElement: []ldListItem{
+			{ldThing: ldThing{Type: "ListItem"}, Position: 1, Name: config.siteName(), Item: config.absURL("/")},
+			{ldThing: ldThing{Type: "ListItem"}, Position: 2, Name: p.Title, Item: url},
+		},
+	}
+
+	return ldScripts(posting, breadcrumbs)
+}
+
+func ldAuthor(config *Config) *ldPerson {
+	if config.Author.Name == "" {
+		return nil
+	}
+	return &ldPerson{
+		ldThing: ldThing{Type: "Person"},
+		Name:    config.Author.Name,
+		URL:     config.Author.URL,
+	}
+}
+
+// ldPublisher is the configured publisher, or the site itself.
+func ldPublisher(config *Config) *ldOrganization {
+	publisher := &ldOrganization{
+		ldThing: ldThing{Type: "Organization"},
+		Name:    config.Publisher.Name,
+		URL:     config.Publisher.URL,
+	}
+	if publisher.Name == "" {
+		publisher.Name = config.siteName()
+		publisher.URL = config.absURL("/")
+	}
+	if config.Publisher.Logo != "" {
+		publisher.Logo = &ldImage{
+			ldThing: ldThing{Type: "ImageObject"},
+			URL:     config.absURL(config.Publisher.Logo),
+		}
+	}
+	return publisher
+}
+
+// ldScripts marshals each value into its own script tag. json.Marshal
+// escapes <, > and &, so the JSON can't close the tag early.
+func ldScripts(values ...any) (string, error) {
+	var b strings.Builder
+	for _, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("<script type=\"application/ld+json\">\n")
+		b.Write(data)
+		b.WriteString("\n</script>\n")
+	}
+	return b.String(), nil
+}
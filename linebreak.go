@@ -0,0 +1,149 @@
+package nebel
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Line breaking for OG titles: a simplified UAX #14 for Latin text (break
+// at spaces and after hyphens, never inside a word) combined with
+// Japanese kinsoku rules (no line starts with closing punctuation, small
+// kana or the prolonged sound mark, and no line ends with an opening
+// bracket).
+
+type breakClass int
+
+const (
+	classAlphabetic breakClass = iota
+	classSpace
+	classIdeographic
+	classOpen
+	classClose
+	classHyphen
+)
+
+// Characters that must not start a line (行頭禁則)
+const noLineStart = "、。，．,.・：；:;？！?!）)］]｝}〕〉》」』】〙〗〟’”｠»" +
+	"ヽヾーァィゥェォッャュョヮヵヶぁぃぅぇぉっゃゅょゎゕゖㇰㇱㇲㇳㇴㇵㇶㇷㇸㇹㇺㇻㇼㇽㇾㇿ々〻" +
+	"‐゠–―〜～…‥%％"
+
+// Characters that must not end a line (行末禁則)
+const noLineEnd = "（(［[｛{〔〈《「『【〘〖〝‘“｟«"
+
+func classifyRune(r rune) breakClass {
+	switch {
+	case r == ' ' || r == '\t':
+		return classSpace
+	case strings.ContainsRune(noLineStart, r):
+		return classClose
+	case strings.ContainsRune(noLineEnd, r):
+		return classOpen
+	case r == '-' || r == '—' || r == '/':
+		return classHyphen
+	case isCJK(r) || unicode.Is(unicode.Hangul, r):
+		return classIdeographic
+	default:
+		return classAlphabetic
+	}
+}
+
+// canBreakBetween reports whether a line may break between a and b.
+func canBreakBetween(a, b rune) bool {
+	ca, cb := classifyRune(a), classifyRune(b)
+
+	switch {
+	// Spaces stay at the end of the line before the break
+	case cb == classSpace:
+		return false
+	// Kinsoku, which also keeps "……" and "――" together
+	case cb == classClose:
+		return false
+	case ca == classOpen:
+		return false
+	case ca == classSpace:
+		return true
+	// Break after a hyphen or slash, unless a number follows as in "-1"
+	case ca == classHyphen:
+		return (cb == classAlphabetic && !unicode.IsDigit(b)) || cb == classIdeographic
+	// CJK text may break between any two characters
+	case ca == classIdeographic || cb == classIdeographic:
+		return true
+	// Full-width closing and opening brackets end or start a phrase
+	case ca == classClose && isCJK(a):
+		return true
+	case cb == classOpen && isCJK(b):
+		return true
+	}
+
+	return false
+}
+
+// splitTextForWrapping splits text into the smallest pieces that can't be
+// broken across lines. Spaces stay attached to the piece before them.
+func splitTextForWrapping(text string) []string {
+	runes := []rune(text)
+
+	var segments []string
+	var current strings.Builder
+	for i, r := range runes {
+		if i > 0 && canBreakBetween(runes[i-1], r) {
+			segments = append(segments, current.String())
+			current.Reset()
+		}
+		current.WriteRune(r)
+	}
+
+	if current.Len() > 0 {
+		segments = append(segments, current.String())
+	}
+
+	return segments
+}
+
+func isKanji(r rune) bool {
+	// CJK Unified Ideographs
+	if r >= 0x4E00 && r <= 0x9FFF {
+		return true
+	}
+	// CJK Unified Ideographs Extension A
+	if r >= 0x3400 && r <= 0x4DBF {
+		return true
+	}
+	return false
+}
+
+func isHiragana(r rune) bool {
+	return r >= 0x3040 && r <= 0x309F
+}
+
+func isKatakana(r rune) bool {
+	return (r >= 0x30A0 && r <= 0x30FF) || (r >= 0x31F0 && r <= 0x31FF)
+}
+
+func isCJK(r rune) bool {
+	// CJK Unified Ideographs
+	if r >= 0x4E00 && r <= 0x9FFF {
+		return true
+	}
+	// Hiragana
+	if r >= 0x3040 && r <= 0x309F {
+		return true
+	}
+	// Katakana
+	if r >= 0x30A0 && r <= 0x30FF {
+		return true
+	}
+	// CJK Unified Ideographs Extension A
+	if r >= 0x3400 && r <= 0x4DBF {
+		return true
+	}
+	// CJK Symbols and Punctuation
+	if r >= 0x3000 && r <= 0x303F {
+		return true
+	}
+	// Halfwidth and Fullwidth Forms
+	if r >= 0xFF00 && r <= 0xFFEF {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package nebel
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitTextForWrapping(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"latin words", "Hello big world", []string{"Hello ", "big ", "world"}},
+		{"hyphen", "well-known", []string{"well-", "known"}},
+		{"negative number", "count -1", []string{"count ", "-1"}},
+		{"slash", "and/or", []string{"and/", "or"}},
+		{"latin punctuation", "Yes, really!", []string{"Yes, ", "really!"}},
+		{"cjk", "日本語", []string{"日", "本", "語"}},
+		{"latin word in cjk", "Goの型", []string{"Go", "の", "型"}},
+		{"latin words in cjk", "Go言語 is fun", []string{"Go", "言", "語 ", "is ", "fun"}},
+		{"no small kana at line start", "ちょっと", []string{"ちょっ", "と"}},
+		{"no prolonged sound mark at line start", "コード", []string{"コー", "ド"}},
+		{"no closing punctuation at line start", "はい、そう。", []string{"は", "い、", "そ", "う。"}},
+		{"no opening bracket at line end", "「本」を", []string{"「本」", "を"}},
+		{"ellipsis stays together", "待って……", []string{"待っ", "て……"}},
+		{"full-width brackets", "（注）日本", []string{"（注）", "日", "本"}},
+		{"latin in brackets", "「Go」の", []string{"「Go」", "の"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitTextForWrapping(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("splitTextForWrapping(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
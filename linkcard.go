@@ -0,0 +1,393 @@
+package nebel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const linkCardCachePath = "data/linkcards.json"
+
+// LinkCard holds the OGP metadata shown for a bare URL in a post.
+type LinkCard struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+
+	// FailedAt and Error record a failed fetch. The URL isn't fetched again
+	// until linkCardRetryInterval has passed, so builds don't keep going
+	// to the network for dead links.
+	FailedAt time.Time `json:"failed_at,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// linkCardRetryInterval is how long a failed fetch is cached.
+const linkCardRetryInterval = 7 * 24 * time.Hour
+
+// LinkCardFetcher retrieves the metadata for a link card.
+type LinkCardFetcher interface {
+	Fetch(url string) (*LinkCard, error)
+}
+
+// DefaultLinkCardFetcher fetches link cards over HTTP. The nebel command
+// sets it as a Site's LinkCards when run with --fetch-link-cards.
+var DefaultLinkCardFetcher LinkCardFetcher = &HTTPLinkCardFetcher{
+	Client: &http.Client{Timeout: 10 * time.Second},
+}
+
+// HTTPLinkCardFetcher fetches a page and reads its OGP tags.
+type HTTPLinkCardFetcher struct {
+	Client *http.Client
+}
+
+func (f *HTTPLinkCardFetcher) Fetch(rawURL string) (*LinkCard, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "nebel (+https://github.com/mizzy/nebel)")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, 1<<20), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	card, err := parseOGP(body)
+	if err != nil {
+		return nil, err
+	}
+	card.URL = rawURL
+
+	// Resolve a relative og:image against the final URL after redirects
+	if card.Image != "" {
+		if ref, err := url.Parse(card.Image); err == nil {
+			card.Image = resp.Request.URL.ResolveReference(ref).String()
+		}
+	}
+
+	if card.SiteName == "" {
+		card.SiteName = resp.Request.URL.Hostname()
+	}
+
+	return card, nil
+}
+
+// parseOGP reads og:* meta tags from the <head> of an HTML document,
+// falling back to <title> and the description meta tag.
+func parseOGP(r io.Reader) (*LinkCard, error) {
+	card := &LinkCard{}
+	var title, description string
+
+	z := xhtml.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return withOGPFallbacks(card, title, description), nil
+			}
+			return nil, z.Err()
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "title":
+				inTitle = tt == xhtml.StartTagToken
+			case "meta":
+				var key, content string
+				for _, attr := range tok.Attr {
+					switch attr.Key {
+					case "property", "name":
+						key = strings.ToLower(attr.Val)
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				switch key {
+				case "og:title":
+					card.Title = content
+				case "og:description":
+					card.Description = content
+				case "og:image":
+					card.Image = content
+				case "og:site_name":
+					card.SiteName = content
+				case "description":
+					description = content
+				}
+			case "body":
+				// OGP tags live in <head>; no need to read the rest
+				return withOGPFallbacks(card, title, description), nil
+			}
+		case xhtml.TextToken:
+			if inTitle {
+				title += strings.TrimSpace(string(z.Text()))
+			}
+		case xhtml.EndTagToken:
+			if tok := z.Token(); tok.Data == "title" {
+				inTitle = false
+			}
+		}
+	}
+}
+
+func withOGPFallbacks(card *LinkCard, title, description string) *LinkCard {
+	if card.Title == "" {
+		card.Title = title
+	}
+	if card.Description == "" {
+		card.Description = description
+	}
+	return card
+}
+
+// linkCardCache keeps fetched metadata in a file committed with the site,
+// so builds are reproducible and don't need the network.
+type linkCardCache struct {
+	// path is the file on disk new cards are saved to; they aren't saved
+	// when it's empty.
+	path    string
+	cards   map[string]*LinkCard
+	fetcher LinkCardFetcher
+	dirty   bool
+	// warn reports failed fetches; they're ignored when it's nil.
+	warn func(format string, args ...any)
+}
+
+// loadLinkCardCache reads data/linkcards.json from src.
+func loadLinkCardCache(src fs.FS, path string, fetcher LinkCardFetcher) (*linkCardCache, error) {
+	c := &linkCardCache{
+		path:    path,
+		cards:   map[string]*LinkCard{},
+		fetcher: fetcher,
+	}
+
+	data, err := fs.ReadFile(src, linkCardCachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &c.cards); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// get returns the card for url, fetching it on a cache miss when the cache
+// has a fetcher. A failed fetch is cached too and retried after
+// linkCardRetryInterval. Without a fetcher the cache is only read, and a
+// link it has no card for is rendered as a plain link.
+func (c *linkCardCache) get(url string) *LinkCard {
+	card, ok := c.cards[url]
+	if ok && card.FailedAt.IsZero() {
+		return card
+	}
+	if c.fetcher == nil {
+		return nil
+	}
+	if ok && time.Since(card.FailedAt) < linkCardRetryInterval {
+		c.warnf("no link card for %s: %s (retrying after %s)", url, card.Error, card.FailedAt.Add(linkCardRetryInterval).Format("2006-01-02"))
+		return nil
+	}
+
+	card, err := c.fetcher.Fetch(url)
+	if err == nil && card.Title == "" {
+		err = errors.New("the page has no title")
+	}
+	if err != nil {
+		c.warnf("no link card for %s: %v", url, err)
+		c.cards[url] = &LinkCard{URL: url, FailedAt: time.Now().UTC().Truncate(time.Second), Error: err.Error()}
+		c.dirty = true
+		return nil
+	}
+
+	c.cards[url] = card
+	c.dirty = true
+
+	return card
+}
+
+func (c *linkCardCache) warnf(format string, args ...any) {
+	if c.warn != nil {
+		c.warn(format, args...)
+	}
+}
+
+func (c *linkCardCache) save() error {
+	if !c.dirty || c.path == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.cards); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return os.WriteFile(c.path, buf.Bytes(), 0644)
+}
+
+var kindLinkCard = ast.NewNodeKind("LinkCard")
+
+type linkCardNode struct {
+	ast.BaseBlock
+	card *LinkCard
+}
+
+func (n *linkCardNode) Kind() ast.NodeKind {
+	return kindLinkCard
+}
+
+func (n *linkCardNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"URL": n.card.URL}, nil)
+}
+
+// linkCardExtension renders paragraphs consisting only of a URL as link cards.
+type linkCardExtension struct {
+	cache *linkCardCache
+}
+
+func (e *linkCardExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(e, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(e, 500),
+	))
+}
+
+func (e *linkCardExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var paragraphs []*ast.Paragraph
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if p, ok := n.(*ast.Paragraph); ok && entering {
+			paragraphs = append(paragraphs, p)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, p := range paragraphs {
+		u := standaloneURL(p, source)
+		if u == "" {
+			continue
+		}
+
+		card := e.cache.get(u)
+		if card == nil {
+			continue
+		}
+
+		p.Parent().ReplaceChild(p.Parent(), p, &linkCardNode{card: card})
+	}
+}
+
+// standaloneURL returns the URL if the paragraph contains nothing but a
+// bare URL (or a link whose text is its own URL), otherwise "".
+func standaloneURL(p *ast.Paragraph, source []byte) string {
+	var found string
+	for c := p.FirstChild(); c != nil; c = c.NextSibling() {
+		switch n := c.(type) {
+		case *ast.Text:
+			if len(strings.TrimSpace(string(n.Segment.Value(source)))) > 0 {
+				return ""
+			}
+			continue
+		case *ast.AutoLink:
+			if found != "" || n.AutoLinkType != ast.AutoLinkURL {
+				return ""
+			}
+			found = string(n.URL(source))
+		case *ast.Link:
+			if found != "" || string(n.Text(source)) != string(n.Destination) {
+				return ""
+			}
+			found = string(n.Destination)
+		default:
+			return ""
+		}
+	}
+
+	if !strings.HasPrefix(found, "http://") && !strings.HasPrefix(found, "https://") {
+		return ""
+	}
+
+	return found
+}
+
+func (e *linkCardExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindLinkCard, e.renderLinkCard)
+}
+
+func (e *linkCardExtension) renderLinkCard(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	card := node.(*linkCardNode).card
+
+	fmt.Fprintf(w, "<div class=\"link-card\"><a href=\"%s\" target=\"_blank\" rel=\"noopener\">\n", html.EscapeString(card.URL))
+	_, _ = w.WriteString("<div class=\"link-card-body\">\n")
+	fmt.Fprintf(w, "<div class=\"link-card-title\">%s</div>\n", html.EscapeString(card.Title))
+	if card.Description != "" {
+		fmt.Fprintf(w, "<div class=\"link-card-description\">%s</div>\n", html.EscapeString(card.Description))
+	}
+	if card.SiteName != "" {
+		fmt.Fprintf(w, "<div class=\"link-card-site\">%s</div>\n", html.EscapeString(card.SiteName))
+	}
+	_, _ = w.WriteString("</div>\n")
+	if card.Image != "" {
+		fmt.Fprintf(w, "<div class=\"link-card-image\"><img src=\"%s\" alt=\"\" loading=\"lazy\" /></div>\n", html.EscapeString(card.Image))
+	}
+	_, _ = w.WriteString("</a></div>\n")
+
+	return ast.WalkContinue, nil
+}
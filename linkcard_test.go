@@ -0,0 +1,176 @@
+package nebel
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// linkCardServer serves a page with OGP tags at /ok, a page without a title
+// at /untitled and a 404 everywhere else, counting the requests.
+func linkCardServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, `<html><head>
+<meta property="og:title" content="Example &amp; Co">
+<meta property="og:description" content="An example page">
+<meta property="og:image" content="/card.png">
+</head><body></body></html>`)
+		case "/untitled":
+			fmt.Fprint(w, `<html><head></head><body>no title</body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestHTTPLinkCardFetcher(t *testing.T) {
+	srv, _ := linkCardServer(t)
+	fetcher := &HTTPLinkCardFetcher{Client: srv.Client()}
+
+	card, err := fetcher.Fetch(srv.URL + "/ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LinkCard{
+		URL:         srv.URL + "/ok",
+		Title:       "Example & Co",
+		Description: "An example page",
+		Image:       srv.URL + "/card.png",
+		SiteName:    "127.0.0.1",
+	}
+	if *card != want {
+		t.Errorf("Fetch() = %+v, want %+v", *card, want)
+	}
+
+	if _, err := fetcher.Fetch(srv.URL + "/missing"); err == nil {
+		t.Error("Fetch() of a 404 succeeded")
+	}
+}
+
+func TestLinkCardCache(t *testing.T) {
+	srv, hits := linkCardServer(t)
+	savePath := filepath.Join(t.TempDir(), "linkcards.json")
+
+	var warnings []string
+	load := func(src fstest.MapFS) *linkCardCache {
+		c, err := loadLinkCardCache(src, savePath, &HTTPLinkCardFetcher{Client: srv.Client()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.warn = func(format string, args ...any) {
+			warnings = append(warnings, fmt.Sprintf(format, args...))
+		}
+		return c
+	}
+
+	c := load(fstest.MapFS{})
+	if card := c.get(srv.URL + "/ok"); card == nil || card.Title != "Example & Co" {
+		t.Fatalf("get(/ok) = %+v", card)
+	}
+	for _, path := range []string{"/missing", "/untitled"} {
+		if card := c.get(srv.URL + path); card != nil {
+			t.Errorf("get(%s) = %+v, want nil", path, card)
+		}
+	}
+	if len(warnings) != 2 {
+		t.Errorf("warnings = %q, want one per failed fetch", warnings)
+	}
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next build reads everything, failures included, from the cache
+	data, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits.Store(0)
+	warnings = nil
+	c = load(fstest.MapFS{linkCardCachePath: {Data: data}})
+	if card := c.get(srv.URL + "/ok"); card == nil {
+		t.Error("cached card is missing")
+	}
+	if card := c.get(srv.URL + "/missing"); card != nil {
+		t.Errorf("cached failure returned %+v", card)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("made %d requests, want none", n)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "/missing") {
+		t.Errorf("warnings = %q, want the cached failure", warnings)
+	}
+
+	// A failure is retried once it's old enough
+	c.cards[srv.URL+"/missing"].FailedAt = time.Now().Add(-linkCardRetryInterval - time.Hour)
+	c.get(srv.URL + "/missing")
+	if n := hits.Load(); n != 1 {
+		t.Errorf("made %d requests after the retry interval, want 1", n)
+	}
+}
+
+func TestLinkCardCacheWithoutFetcher(t *testing.T) {
+	srv, hits := linkCardServer(t)
+	savePath := filepath.Join(t.TempDir(), "linkcards.json")
+	cached := `{
+  "` + srv.URL + `/ok": {"url": "` + srv.URL + `/ok", "title": "Cached"},
+  "` + srv.URL + `/missing": {"url": "` + srv.URL + `/missing", "failed_at": "2000-01-01T00:00:00Z", "error": "404"}
+}`
+	c, err := loadLinkCardCache(fstest.MapFS{linkCardCachePath: {Data: []byte(cached)}}, savePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if card := c.get(srv.URL + "/ok"); card == nil || card.Title != "Cached" {
+		t.Errorf("get(/ok) = %+v, want the cached card", card)
+	}
+	// Neither a miss nor an expired failure is fetched
+	for _, path := range []string{"/untitled", "/missing"} {
+		if card := c.get(srv.URL + path); card != nil {
+			t.Errorf("get(%s) = %+v, want nil", path, card)
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("made %d requests, want none", n)
+	}
+
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(savePath); err == nil {
+		t.Error("the cache was saved without a fetcher")
+	}
+}
+
+func TestLinkCardRendering(t *testing.T) {
+	srv, _ := linkCardServer(t)
+	c, err := loadLinkCardCache(fstest.MapFS{}, "", &HTTPLinkCardFetcher{Client: srv.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Linkify skips IP addresses, so the URLs are autolinks
+	post := &Post{RawContent: "<" + srv.URL + "/ok>\n\nSee <" + srv.URL + "/ok> too.\n\n<" + srv.URL + "/missing>\n"}
+	if err := post.convertMarkdown(newMarkdown(defaultConfig(), nil, c)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(post.ParsedContent, `class="link-card"`); n != 1 {
+		t.Errorf("rendered %d link cards, want 1:\n%s", n, post.ParsedContent)
+	}
+	if !strings.Contains(post.ParsedContent, "Example &amp; Co") {
+		t.Errorf("card title is missing:\n%s", post.ParsedContent)
+	}
+}
@@ -0,0 +1,170 @@
+package nebel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+// ListOptions filter and order the posts printed by ListPosts.
+type ListOptions struct {
+	// Tag keeps posts with this tag.
+	Tag string
+	// Since keeps posts on or after this date, "2006-01-02".
+	Since string
+	// Drafts includes drafts, which have no path.
+	Drafts bool
+	// Sort is "date", "title", "chars" or "words"; "date" when empty.
+	Sort    string
+	Reverse bool
+	JSON    bool
+}
+
+type listedPost struct {
+	Date  time.Time `json:"date"`
+	Title string    `json:"title"`
+	Path  string    `json:"path,omitempty"`
+	Tags  []string  `json:"tags"`
+	Draft bool      `json:"draft"`
+	Chars int       `json:"chars"`
+	Words int       `json:"words"`
+	File  string    `json:"file"`
+}
+
+// ListPosts prints the posts with the path each is published at.
+func (s *Site) ListPosts(opts ListOptions) error {
+	var since time.Time
+	if opts.Since != "" {
+		var err error
+		if since, err = time.ParseInLocation("2006-01-02", opts.Since, postLocation); err != nil {
+			return fmt.Errorf("invalid date %q", opts.Since)
+		}
+	}
+
+	posts, err := loadPosts(s.Source)
+	if err != nil {
+		return err
+	}
+
+	listed := []listedPost{}
+	for _, post := range posts {
+		if post.Draft && !opts.Drafts {
+			continue
+		}
+		if opts.Tag != "" && !slices.Contains(post.Tags, opts.Tag) {
+			continue
+		}
+		if post.Date.Before(since) {
+			continue
+		}
+
+		tags := post.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		listed = append(listed, listedPost{
+			Date:  post.Date,
+			Title: post.Title,
+			Path:  post.Path,
+			Tags:  tags,
+			Draft: post.Draft,
+			Chars: countProse(post.RawContent).Chars,
+			Words: post.WordCount,
+			File:  post.SourcePath,
+		})
+	}
+
+	var less func(a, b listedPost) bool
+	switch opts.Sort {
+	case "", "date":
+		less = func(a, b listedPost) bool { return a.Date.Before(b.Date) }
+	case "title":
+		less = func(a, b listedPost) bool { return a.Title < b.Title }
+	case "chars":
+		less = func(a, b listedPost) bool { return a.Chars < b.Chars }
+	case "words":
+		less = func(a, b listedPost) bool { return a.Words < b.Words }
+	default:
+		return fmt.Errorf("unknown sort key %q", opts.Sort)
+	}
+	sort.SliceStable(listed, func(i, j int) bool {
+		if opts.Reverse {
+			return less(listed[j], listed[i])
+		}
+		return less(listed[i], listed[j])
+	})
+
+	if opts.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
+
+	rows := [][]string{{"DATE", "TITLE", "PATH", "TAGS", "DRAFT", "CHARS", "WORDS", "FILE"}}
+	for _, p := range listed {
+		path := p.Path
+		if path == "" {
+			path = "-"
+		}
+		draft := ""
+		if p.Draft {
+			draft = "draft"
+		}
+		rows = append(rows, []string{
+			p.Date.Format("2006-01-02 15:04"), p.Title, path, strings.Join(p.Tags, ","), draft,
+			strconv.Itoa(p.Chars), strconv.Itoa(p.Words), p.File,
+		})
+	}
+	return writeColumns(os.Stdout, rows)
+}
+
+// writeColumns prints rows as space-padded columns. Unlike text/tabwriter it
+// pads by display width, so East Asian wide characters keep columns aligned.
+func writeColumns(w io.Writer, rows [][]string) error {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+	for _, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			b.WriteString(cell)
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		b.WriteByte('\n')
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayWidth returns the number of terminal columns s occupies.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			n += 2
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,24 @@
+package nebel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteColumns(t *testing.T) {
+	var b strings.Builder
+	err := writeColumns(&b, [][]string{
+		{"TITLE", "PATH"},
+		{"Hello", "/a"},
+		{"日本語", "/b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "TITLE   PATH\n" +
+		"Hello   /a\n" +
+		"日本語  /b\n"
+	if got := b.String(); got != want {
+		t.Errorf("writeColumns =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package nebel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+)
+
+// manifestName lists the files the last build wrote to the output, so the
+// next one can tell which of them it no longer produces.
+const manifestName = ".nebel-manifest.json"
+
+type manifest struct {
+	// Files are paths relative to the output, with forward slashes.
+	Files []string `json:"files"`
+	// Sums hash what each post's page and OG images were made from, so
+	// the files of older posts are only rewritten when that changes or
+	// they go missing.
+	Sums map[string]string `json:"sums,omitempty"`
+}
+
+func loadManifest(out Output) (*manifest, error) {
+	data, err := out.ReadFile(manifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func saveManifest(out Output, files map[string]bool, sums map[string]string) error {
+	m := manifest{Files: []string{}, Sums: map[string]string{}}
+	for f := range files {
+		m.Files = append(m.Files, f)
+		if sum, ok := sums[f]; ok {
+			m.Sums[f] = sum
+		}
+	}
+	slices.Sort(m.Files)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return out.WriteFile(manifestName, append(data, '\n'))
+}
+
+// pruneOutputs removes the files the previous build wrote that this one
+// didn't, such as the page of a deleted or re-dated post, and then records
+// this build's files. Files nebel never wrote are left alone. In a dry run
+// nothing is removed, and the manifest keeps the stale files so a later
+// build still removes them.
+func pruneOutputs(out Output, log *buildLog) error {
+	var stale []string
+	for _, f := range log.previous.Files {
+		if !log.outputs[f] {
+			stale = append(stale, f)
+		}
+	}
+	slices.Sort(stale)
+
+	for _, f := range stale {
+		log.removed(f)
+		if log.dryRun {
+			log.outputs[f] = true
+			continue
+		}
+		if err := out.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return buildError(PhasePrune, f, err)
+		}
+	}
+
+	return buildError(PhasePrune, manifestName, saveManifest(out, log.outputs, log.sums))
+}
+
+// upToDate reports whether the previous build wrote name from the inputs
+// hashed as sum and the file is still in out.
+func (l *buildLog) upToDate(out Output, name, sum string) bool {
+	if sum == "" || l.previous.Sums[name] != sum {
+		return false
+	}
+	return outputExists(out, name)
+}
+
+// sumBytes hashes a file's contents for the manifest.
+func sumBytes(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// sumSources hashes values, encoded as JSON, along with the files named
+// in src. It returns "" if a file can't be read, which never matches the
+// manifest, so the output is rebuilt and the error reported then.
+func sumSources(src fs.FS, files []string, values ...any) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			return ""
+		}
+	}
+	for _, name := range files {
+		if name == "" {
+			continue
+		}
+		data, err := readSourceFile(src, name)
+		if err != nil {
+			return ""
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Clean removes the files the last build wrote, as listed in the
+// manifest, and then the manifest, so the next build writes every post
+// again. Files nebel didn't write, such as the .git of a deploy checkout,
+// are left alone. With dryRun it only prints what it would remove.
+func (s *Site) Clean(dryRun bool) error {
+	m, err := loadManifest(s.Output)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range append(m.Files, manifestName) {
+		if !outputExists(s.Output, name) {
+			continue
+		}
+		if dryRun {
+			fmt.Println("would remove", name)
+			continue
+		}
+		if err := s.Output.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Println("removed", name)
+	}
+	return nil
+}
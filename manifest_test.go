@@ -0,0 +1,224 @@
+package nebel
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func newTestLog() *buildLog {
+	log := newBuildLog(false, true)
+	log.out = io.Discard
+	return log
+}
+
+// writeTestSite writes src to a temporary directory and returns it.
+func writeTestSite(t *testing.T, src fstest.MapFS) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, file := range src {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, file.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPruneOutputs(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dryRun=%v", dryRun), func(t *testing.T) {
+			// The previous build wrote gone.html, which has since been
+			// removed by hand
+			out := MemoryOutput{
+				"kept.html":  []byte("kept"),
+				"stale.html": []byte("stale"),
+				"mine.txt":   []byte("not nebel's"),
+			}
+			if err := saveManifest(out, map[string]bool{"kept.html": true, "stale.html": true, "gone.html": true}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			log := newTestLog()
+			log.dryRun = dryRun
+			var err error
+			if log.previous, err = loadManifest(out); err != nil {
+				t.Fatal(err)
+			}
+			log.keep("kept.html")
+			log.page("new.html")
+			log.sums["new.html"] = "sum"
+
+			if err := pruneOutputs(out, log); err != nil {
+				t.Fatal(err)
+			}
+
+			if want := []string{"gone.html", "stale.html"}; !slices.Equal(log.report.Removed, want) {
+				t.Errorf("removed %q, want %q", log.report.Removed, want)
+			}
+			if _, ok := out["stale.html"]; ok == !dryRun {
+				t.Errorf("stale.html exists = %v in a dry run = %v", ok, dryRun)
+			}
+			if _, ok := out["mine.txt"]; !ok {
+				t.Error("removed a file nebel didn't write")
+			}
+
+			m, err := loadManifest(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"kept.html", "new.html"}
+			if dryRun {
+				// The stale files stay listed so a real build removes them
+				want = []string{"gone.html", "kept.html", "new.html", "stale.html"}
+			}
+			if !slices.Equal(m.Files, want) {
+				t.Errorf("manifest files = %q, want %q", m.Files, want)
+			}
+			if m.Sums["new.html"] != "sum" {
+				t.Errorf("manifest sums = %v", m.Sums)
+			}
+		})
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	out := MemoryOutput{"a.html": []byte("a")}
+	log := newTestLog()
+	log.previous = &manifest{Sums: map[string]string{"a.html": "x", "b.html": "y"}}
+
+	tests := []struct {
+		name, sum string
+		want      bool
+	}{
+		{"a.html", "x", true},
+		{"a.html", "z", false},
+		{"a.html", "", false},
+		{"b.html", "y", false}, // missing from the output
+		{"c.html", "", false},
+	}
+	for _, tt := range tests {
+		if got := log.upToDate(out, tt.name, tt.sum); got != tt.want {
+			t.Errorf("upToDate(%s, %q) = %v, want %v", tt.name, tt.sum, got, tt.want)
+		}
+	}
+}
+
+// testSite is a site of n posts, one a day from 2024-01-01, with small
+// OG images to keep the build fast.
+func testSite(n int) fstest.MapFS {
+	src := fstest.MapFS{
+		"config.yaml": {Data: []byte(`title: Test
+base_url: https://example.com
+og:
+  variants:
+    - width: 120
+      height: 63
+`)},
+	}
+	for i := 1; i <= n; i++ {
+		src[fmt.Sprintf("posts/2024-01-%02d-post-%d.markdown", i, i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf(
+			"---\ntitle: Post %d\ndate: 2024-01-%02d 10:00:00 +0900\n---\n\nBody of post %d.\n", i, i, i))}
+	}
+	return src
+}
+
+func TestIncrementalBuild(t *testing.T) {
+	src := testSite(12)
+	out := MemoryOutput{}
+	site := &Site{Source: src, Output: out}
+	build := func() *BuildReport {
+		t.Helper()
+		report, err := site.Build(BuildOptions{Quiet: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	// The first build writes every post; the next only the recent ones
+	if r := build(); r.Pages != 14 || r.Images != 13 {
+		t.Errorf("first build wrote %d pages and %d images", r.Pages, r.Images)
+	}
+	if r := build(); r.Pages != 11 || r.Images != 10 {
+		t.Errorf("second build wrote %d pages and %d images", r.Pages, r.Images)
+	}
+
+	// Older posts whose files went missing or whose content changed are
+	// written again, and so is the page of post 2, which links to post 3
+	delete(out, "blog/2024/01/01/1/index.html")
+	delete(out, "blog/2024/01/02/1/ogp.png")
+	src["posts/2024-01-03-post-3.markdown"].Data = []byte("---\ntitle: Renamed\ndate: 2024-01-03 10:00:00 +0900\n---\n\nNew body.\n")
+	if r := build(); r.Pages != 14 || r.Images != 12 {
+		t.Errorf("rebuild wrote %d pages and %d images", r.Pages, r.Images)
+	}
+	if _, ok := out["blog/2024/01/01/1/index.html"]; !ok {
+		t.Error("missing page wasn't written")
+	}
+	if _, ok := out["blog/2024/01/02/1/ogp.png"]; !ok {
+		t.Error("missing OG image wasn't written")
+	}
+	if page := string(out["blog/2024/01/03/1/index.html"]); !strings.Contains(page, "Renamed") {
+		t.Error("changed page wasn't written")
+	}
+
+	// Switching the OG format rewrites every page to point at the new
+	// images and removes the old ones
+	src["config.yaml"].Data = []byte(strings.Replace(string(src["config.yaml"].Data), "height: 63", "height: 63\n      format: jpeg", 1))
+	build()
+	for name, data := range out {
+		if strings.HasSuffix(name, "ogp.png") {
+			t.Errorf("%s wasn't removed", name)
+		}
+		if strings.HasSuffix(name, "index.html") && strings.Contains(string(data), "ogp.png") {
+			t.Errorf("%s still refers to ogp.png", name)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	dir := writeTestSite(t, testSite(2))
+	site := NewSite(dir)
+	if _, err := site.Build(BuildOptions{Quiet: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := site.Output.(DirOutput)
+	if err := out.WriteFile(".git/HEAD", []byte("ref: refs/heads/main\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.WriteFile("CNAME", []byte("example.com\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := site.Clean(true); err != nil {
+		t.Fatal(err)
+	}
+	if !outputExists(out, "index.html") {
+		t.Error("dry run removed index.html")
+	}
+
+	if err := site.Clean(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"index.html", "blog/2024/01/01/1/index.html", manifestName} {
+		if outputExists(out, name) {
+			t.Errorf("%s wasn't removed", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "public", "blog")); err == nil {
+		t.Error("empty directories were left behind")
+	}
+	for _, name := range []string{".git/HEAD", "CNAME"} {
+		if !outputExists(out, name) {
+			t.Errorf("%s, which nebel didn't write, was removed", name)
+		}
+	}
+}
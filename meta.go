@@ -0,0 +1,131 @@
+package nebel
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// summaryLength is how many characters of a post are used as its summary
+// when the front matter doesn't give one.
+const summaryLength = 120
+
+// templateFuncs are the functions available to every layout.
+func templateFuncs(config *Config) template.FuncMap {
+	return template.FuncMap{
+		"formatDate": formatDate,
+		"site": func() *Config {
+			return config
+		},
+		"siteName": config.siteName,
+		"absURL":   config.absURL,
+		"ogMeta": func(p *Post) string {
+			return ogMeta(config, p)
+		},
+		"jsonLD": func(p *Post) (string, error) {
+			return jsonLD(config, p)
+		},
+	}
+}
+
+// ogMeta renders the canonical link, OGP and Twitter Card tags for a post,
+// or for the site when p is the index page.
+func ogMeta(config *Config, p *Post) string {
+	ogType := "article"
+	title := p.Title
+	description := p.Summary
+	url := config.absURL(p.Path + "/")
+	if p.Index {
+		ogType = "website"
+		title = config.siteName()
+		description = config.Description
+		url = config.absURL("/")
+	}
+	image := config.absURL(p.OGImagePath)
+
+	var b strings.Builder
+	link := func(rel, href string) {
+		fmt.Fprintf(&b, "<link rel=\"%s\" href=\"%s\" />\n", rel, html.EscapeString(href))
+	}
+	meta := func(attr, name, content string) {
+		if content == "" {
+			return
+		}
+		fmt.Fprintf(&b, "<meta %s=\"%s\" content=\"%s\" />\n", attr, name, html.EscapeString(content))
+	}
+
+	link("canonical", url)
+	meta("property", "og:type", ogType)
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	meta("property", "og:url", url)
+	meta("property", "og:site_name", config.siteName())
+	// Crawlers take the first image they support
+	for _, img := range p.OGImages {
+		meta("property", "og:image", config.absURL(img.Path))
+		meta("property", "og:image:type", img.Type)
+		if img.Width > 0 {
+			meta("property", "og:image:width", fmt.Sprint(img.Width))
+			meta("property", "og:image:height", fmt.Sprint(img.Height))
+		}
+	}
+	if !p.Index {
+		meta("property", "article:published_time", p.Date.Format(time.RFC3339))
+	}
+	meta("name", "twitter:card", "summary_large_image")
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	meta("name", "twitter:image", image)
+
+	return b.String()
+}
+
+// summarize returns the start of the text of rendered post HTML, leaving
+// out code blocks, link cards and diagrams.
+func summarize(content string, length int) string {
+	var b strings.Builder
+	skip := 0
+
+	z := xhtml.NewTokenizer(strings.NewReader(content))
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			return truncate(strings.Join(strings.Fields(b.String()), " "), length)
+		case xhtml.StartTagToken:
+			if skippedInSummary(z) {
+				skip++
+			}
+		case xhtml.EndTagToken:
+			if skippedInSummary(z) && skip > 0 {
+				skip--
+			}
+		case xhtml.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+				b.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func skippedInSummary(z *xhtml.Tokenizer) bool {
+	name, _ := z.TagName()
+	switch string(name) {
+	// Link cards and mermaid diagrams are rendered as divs
+	case "pre", "figure", "div", "script", "style":
+		return true
+	}
+	return false
+}
+
+func truncate(s string, length int) string {
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	return string([]rune(s)[:length]) + "…"
+}
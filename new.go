@@ -1,29 +1,214 @@
 package nebel
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
 	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
-func CreateNewPost(title string) error {
-	now := time.Now()
-	date := now.Format("2006-01-02")
-	location, _ := time.LoadLocation("Asia/Tokyo")
-	dateTime := now.In(location).Format("2006-01-02 15:04:05 +0900")
+// NewPostOptions are the optional settings of a new post.
+type NewPostOptions struct {
+	// Slug names the file. When empty it's made from the title, or from
+	// the time of day for a title without ASCII letters or digits,
+	// numbered if a post of that day already has it.
+	Slug  string
+	Tags  []string
+	Draft bool
+	// Date is "2006-01-02", "2006-01-02 15:04" or "2006-01-02 15:04:05";
+	// the current time when empty.
+	Date string
+	// Edit opens the new post in $EDITOR.
+	Edit bool
+	// Kind picks the archetype, archetypes/<kind>.md; "post" when empty.
+	Kind string
+}
+
+const archetypesDir = "archetypes"
 
-	template := `---
-title: %s
-date: %s
----
-	`
+// archetypeData is what an archetype template can use.
+type archetypeData struct {
+	Kind   string
+	Title  string
+	Slug   string
+	Author string
+	Tags   []string
+	Draft  bool
+	// Date is formatted for front matter.
+	Date string
+}
 
-	template = fmt.Sprintf(template, title, dateTime)
+// CreateNewPost writes posts/<date>-<slug>.markdown in the site's Dir from
+// an archetype and returns its path. It never overwrites an existing file.
+func (s *Site) CreateNewPost(title string, opts NewPostOptions) (string, error) {
+	if s.Dir == "" {
+		return "", errors.New("the site has no directory to write the post to")
+	}
 
-	err := os.WriteFile(fmt.Sprintf("posts/%s-%s.markdown", date, title), []byte(template), 0644)
+	config, err := loadConfig(s.Source)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	date := time.Now().In(postLocation)
+	if opts.Date != "" {
+		date = parseNewPostDate(opts.Date)
+		if date.IsZero() {
+			return "", fmt.Errorf("invalid date %q", opts.Date)
+		}
+	}
+
+	slug := opts.Slug
+	numbered := false
+	if slug == "" {
+		slug = slugify(title)
+		if slug == "" {
+			slug = date.Format("150405")
+			numbered = true
+		}
+	}
+	if slug != slugify(slug) {
+		return "", fmt.Errorf("invalid slug %q; use lowercase letters, digits and hyphens", slug)
+	}
+
+	kind := opts.Kind
+	if kind == "" {
+		kind = "post"
+	}
+	tmpl, err := loadArchetype(s.Source, kind)
+	if err != nil {
+		return "", err
+	}
+
+	// A slug from the time of day is 000000 for every post given only a
+	// date, so it's numbered rather than refused when it's taken.
+	base := slug
+	for n := 2; ; n++ {
+		var content bytes.Buffer
+		if err := tmpl.Execute(&content, archetypeData{
+			Kind:   kind,
+			Title:  title,
+			Slug:   slug,
+			Author: config.Author.Name,
+			Tags:   opts.Tags,
+			Draft:  opts.Draft,
+			Date:   date.Format("2006-01-02 15:04:05 +0900"),
+		}); err != nil {
+			return "", err
+		}
+
+		path := filepath.Join(s.Dir, "posts", fmt.Sprintf("%s-%s.markdown", date.Format("2006-01-02"), slug))
+		created, err := createFile(path, content.Bytes())
+		if err != nil {
+			return "", err
+		}
+		if created {
+			if opts.Edit {
+				return path, openEditor(path)
+			}
+			return path, nil
+		}
+		if !numbered {
+			return "", fmt.Errorf("%s already exists", path)
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// createFile writes data to a new file at path, returning false if the
+// file already exists.
+func createFile(path string, data []byte) (bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// loadArchetype parses archetypes/<kind>.md, falling back to the default
+// archetypes.
+func loadArchetype(src fs.FS, kind string) (*template.Template, error) {
+	name := path.Join(archetypesDir, kind+".md")
+	data, err := readSiteFile(src, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no archetype for %q: %s doesn't exist", kind, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return template.New(kind).Funcs(template.FuncMap{"quote": quoteYAML}).Parse(string(data))
+}
+
+// quoteYAML makes s a double-quoted YAML string, which JSON strings are.
+func quoteYAML(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// parseNewPostDate accepts a date with or without a time of day.
+func parseNewPostDate(s string) time.Time {
+	if t, err := time.ParseInLocation("2006-01-02", s, postLocation); err == nil {
+		return t
+	}
+	return parsePostDate(s)
+}
+
+// slugify lowercases s and joins its runs of ASCII letters and digits with
+// hyphens. Accents are stripped first, so "Café" gives "cafe"; everything
+// else, including Japanese, is dropped, so a title with no ASCII words
+// gives an empty slug.
+func slugify(s string) string {
+	var words []string
+	var word strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			word.WriteRune(r)
+			continue
+		}
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return strings.Join(words, "-")
+}
+
+// openEditor runs $EDITOR on path, which may include arguments such as
+// "code --wait".
+func openEditor(path string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		return errors.New("$EDITOR is not set")
 	}
 
-	return nil
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
 }
@@ -0,0 +1,24 @@
+package nebel
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go 1.24 released  ", "go-1-24-released"},
+		{"already-a-slug", "already-a-slug"},
+		{"C++ & Rust", "c-rust"},
+		{"Go言語入門", "go"},
+		{"日本語のタイトル", ""},
+		{"Café crème", "cafe-creme"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := slugify(tt.in); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
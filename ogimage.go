@@ -3,11 +3,18 @@ package nebel
 import (
 	"bytes"
 	_ "embed"
+	"fmt"
 	"image"
 	"image/color"
-	_ "image/png"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"math"
+	"mime"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fogleman/gg"
 	"golang.org/x/image/font"
@@ -20,357 +27,748 @@ var fontData []byte
 //go:embed assets/avatar.png
 var avatarData []byte
 
-const (
-	ogImageWidth  = 1200
-	ogImageHeight = 630
-)
+// ogRenderer draws OG images with the fonts and images of an OGTheme
+// loaded once per build.
+type ogRenderer struct {
+	// src is the site the theme's fonts and images and posts' covers are
+	// read from.
+	src         fs.FS
+	theme       OGTheme
+	titleFonts  fontChain
+	footerFonts fontChain
+	avatar      image.Image
+	background  image.Image
+	bgColor     color.Color
+	bgGradient  []color.Color
+	titleColor  color.RGBA
+	footerColor color.RGBA
+	// sum hashes the theme and the files it uses, for the manifest.
+	sum string
+}
 
-func (p *Post) generateOGImage(outputDir string) error {
-	dc := gg.NewContext(ogImageWidth, ogImageHeight)
+func newOGRenderer(src fs.FS, theme OGTheme) (*ogRenderer, error) {
+	r := &ogRenderer{src: src, theme: theme}
+	r.sum = sumSources(src, append([]string{theme.Font, theme.FooterFont, theme.Avatar.Path, theme.Background.Image}, theme.FallbackFonts...), theme)
 
-	// Draw background
-	drawBackground(dc)
+	var err error
+	if r.titleFonts, err = loadFontChain(src, theme.Font, theme.FallbackFonts); err != nil {
+		return nil, err
+	}
+	if r.footerFonts, err = loadFontChain(src, theme.FooterFont, theme.FallbackFonts); err != nil {
+		return nil, err
+	}
+
+	if theme.Avatar.Shape != "none" {
+		if r.avatar, err = loadImage(src, theme.Avatar.Path, avatarData); err != nil {
+			return nil, err
+		}
+	}
 
-	// Load font
-	f, err := opentype.Parse(fontData)
+	switch theme.Background.Type {
+	case "solid":
+		if r.bgColor, err = parseColor(theme.Background.Color); err != nil {
+			return nil, err
+		}
+	case "gradient":
+		if len(theme.Background.Colors) < 2 {
+			return nil, fmt.Errorf("og: a gradient background needs at least two colors")
+		}
+		for _, s := range theme.Background.Colors {
+			c, err := parseColor(s)
+			if err != nil {
+				return nil, err
+			}
+			r.bgGradient = append(r.bgGradient, c)
+		}
+	case "image":
+		if theme.Background.Image == "" {
+			return nil, fmt.Errorf("og: an image background needs an image path")
+		}
+		if r.background, err = loadImage(src, theme.Background.Image, nil); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("og: unknown background type %q", theme.Background.Type)
+	}
+
+	if len(theme.Variants) == 0 {
+		return nil, fmt.Errorf("og: at least one variant is required")
+	}
+	for _, v := range theme.Variants {
+		if v.Width <= 0 || v.Height <= 0 {
+			return nil, fmt.Errorf("og: invalid variant size %dx%d", v.Width, v.Height)
+		}
+		if v.Format != "" && v.Format != "png" && v.Format != "jpeg" {
+			return nil, fmt.Errorf("og: unknown variant format %q", v.Format)
+		}
+		if v.Quality < 0 || v.Quality > 100 {
+			return nil, fmt.Errorf("og: JPEG quality %d is out of range", v.Quality)
+		}
+		if v.Colors < 0 || v.Colors > 256 {
+			return nil, fmt.Errorf("og: palette of %d colors is out of range", v.Colors)
+		}
+	}
+
+	if r.titleColor, err = parseColor(theme.TitleColor); err != nil {
+		return nil, err
+	}
+	if r.footerColor, err = parseColor(theme.FooterColor); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// loadFont parses the font file at path in src, or the embedded Noto Sans
+// CJK Bold when path is empty.
+func loadFont(src fs.FS, path string) (*opentype.Font, error) {
+	data := fontData
+	if path != "" {
+		var err error
+		if data, err = readSourceFile(src, path); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fontName(path), err)
+	}
+	return f, nil
+}
+
+func fontName(path string) string {
+	if path == "" {
+		return "NotoSansCJKjp-Bold.otf"
+	}
+	return path
+}
+
+// loadImage decodes the image at path in src, or fallback when path is
+// empty.
+func loadImage(src fs.FS, path string, fallback []byte) (image.Image, error) {
+	data := fallback
+	if path != "" {
+		var err error
+		if data, err = readSourceFile(src, path); err != nil {
+			return nil, err
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// parseColor parses #rgb, #rrggbb or #rrggbbaa.
+func parseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	var c color.RGBA
+	if len(hex) != 8 {
+		return c, fmt.Errorf("invalid color %q", s)
+	}
+	if _, err := fmt.Sscanf(hex, "%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A); err != nil {
+		return c, fmt.Errorf("invalid color %q", s)
+	}
+	return c, nil
+}
+
+// ogContent is what an OG image shows.
+type ogContent struct {
+	Title    string
+	Subtitle string
+	Date     time.Time
+	// Cover is drawn as the background under a scrim when set.
+	Cover image.Image
+}
+
+// OGImage is one published variant of a page's OG image, as exposed to
+// templates.
+type OGImage struct {
+	Path string
+	// Width and Height are zero for an og_image, which is published as is.
+	Width  int
+	Height int
+	Type   string
+}
+
+// ogImages lists the OG images published in the directory at path:
+// handmade copied as is, or one per variant.
+func ogImages(path, handmade string, variants []OGVariant) []OGImage {
+	if handmade != "" {
+		ext := strings.ToLower(filepath.Ext(handmade))
+		return []OGImage{{Path: path + "/ogp" + ext, Type: mime.TypeByExtension(ext)}}
+	}
+
+	var images []OGImage
+	for i, v := range variants {
+		images = append(images, OGImage{
+			Path:   path + "/" + v.fileName(i),
+			Width:  v.Width,
+			Height: v.Height,
+			Type:   mime.TypeByExtension(v.ext()),
+		})
+	}
+	return images
+}
+
+func (v OGVariant) ext() string {
+	if v.Format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// fileName is ogp.<ext> for the first variant and ogp-<name>.<ext> for the
+// rest.
+func (v OGVariant) fileName(i int) string {
+	if i == 0 {
+		return "ogp" + v.ext()
+	}
+	name := v.Name
+	if name == "" {
+		name = fmt.Sprintf("%dx%d", v.Width, v.Height)
+	}
+	return "ogp-" + name + v.ext()
+}
+
+// generateOGImage writes the post's OG images to dir in out.
+func (p *Post) generateOGImage(out Output, dir string, r *ogRenderer) error {
+	// A hand-made image is published as is
+	if p.OGImage != "" {
+		data, ext, err := p.ogImage(r)
+		if err != nil {
+			return err
+		}
+		return out.WriteFile(path.Join(dir, "ogp"+ext), data)
+	}
+
+	content, err := p.ogContent(r)
 	if err != nil {
 		return err
 	}
 
-	maxWidth := float64(ogImageWidth - 160) // 80px padding on each side
+	return r.writeVariants(out, dir, content)
+}
+
+// ogImage returns the post's main OG image as it's published, along with
+// the file extension it's published with.
+func (p *Post) ogImage(r *ogRenderer) ([]byte, string, error) {
+	if p.OGImage != "" {
+		data, err := readSourceFile(r.src, sitePath(p.OGImage))
+		if err != nil {
+			return nil, "", err
+		}
+		return data, strings.ToLower(filepath.Ext(p.OGImage)), nil
+	}
+
+	content, err := p.ogContent(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	v := r.theme.Variants[0]
+	data, err := r.encode(content, v)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, v.ext(), nil
+}
+
+func (p *Post) ogContent(r *ogRenderer) (ogContent, error) {
+	content := ogContent{
+		Title:    p.Title,
+		Subtitle: p.OGSubtitle,
+		Date:     p.Date,
+	}
+	if p.OGTitle != "" {
+		content.Title = p.OGTitle
+	}
+	if p.OGCover != "" {
+		cover, err := loadImage(r.src, sitePath(p.OGCover), nil)
+		if err != nil {
+			return content, err
+		}
+		content.Cover = cover
+	}
+	return content, nil
+}
+
+// ogSum hashes what the post's OG images are drawn from, for the
+// manifest.
+func (p *Post) ogSum(r *ogRenderer) string {
+	if r.sum == "" {
+		return ""
+	}
+	var files []string
+	if p.OGImage != "" {
+		files = append(files, sitePath(p.OGImage))
+	}
+	if p.OGCover != "" {
+		files = append(files, sitePath(p.OGCover))
+	}
+	return sumSources(r.src, files, r.sum, p.Title, p.OGTitle, p.OGSubtitle, p.Date, p.OGImage, p.OGCover)
+}
+
+// generatePageOGImage writes the OG images for a generated page other than
+// a post, such as the index.
+func (r *ogRenderer) generatePageOGImage(out Output, dir, title string, date time.Time) error {
+	return r.writeVariants(out, dir, ogContent{Title: title, Date: date})
+}
+
+// writeVariants writes c in every configured variant to dir in out.
+func (r *ogRenderer) writeVariants(out Output, dir string, c ogContent) error {
+	for i, v := range r.theme.Variants {
+		data, err := r.encode(c, v)
+		if err != nil {
+			return err
+		}
+		if err := out.WriteFile(path.Join(dir, v.fileName(i)), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode renders c at the size of v and encodes it in v's format.
+func (r *ogRenderer) encode(c ogContent, v OGVariant) ([]byte, error) {
+	img, err := r.render(c, v.Width, v.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case v.Format == "jpeg":
+		quality := v.Quality
+		if quality == 0 {
+			quality = 85
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case v.Colors > 0:
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, quantize(img, v.Colors))
+	default:
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sitePath maps a path from front matter to a file: "/images/a.png" is a
+// URL path served from static/, anything else is relative to the site root.
+func sitePath(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return path.Join("static", p)
+	}
+	return p
+}
+
+func (r *ogRenderer) render(c ogContent, width, height int) (image.Image, error) {
+	dc := gg.NewContext(width, height)
+
+	titleColor, footerColor := r.titleColor, r.footerColor
+
+	// Draw background
+	if c.Cover != nil {
+		drawCover(dc, c.Cover)
+		drawScrim(dc)
+		titleColor = color.RGBA{255, 255, 255, 255}
+		footerColor = color.RGBA{255, 255, 255, 255}
+	} else {
+		r.drawBackground(dc)
+	}
+
+	maxWidth := float64(width) - 2*r.theme.Padding.X
 
 	// Calculate font size and wrap text, reducing font size if too many lines
-	fontSize, lines, err := calculateFontSizeAndWrap(dc, f, p.Title, maxWidth)
+	fontSize, lines, err := calculateFontSizeAndWrap(dc, r.titleFonts, c.Title, maxWidth, r.theme.MaxLines)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	face, err := opentype.NewFace(f, &opentype.FaceOptions{
-		Size:    fontSize,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+	face, err := r.titleFonts.face(fontSize)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	dc.SetFontFace(face)
+	// The subtitle is set at half the title size, but never below 24px
+	var subtitleFace font.Face
+	subtitleSize := math.Max(fontSize/2, 24)
+	subtitleHeight := 0.0
+	if c.Subtitle != "" {
+		subtitleFace, err = r.titleFonts.face(subtitleSize)
+		if err != nil {
+			return nil, err
+		}
+		subtitleHeight = subtitleSize*1.4 + fontSize*0.3
+	}
 
-	// Text color (dark gray for white background)
-	dc.SetColor(color.RGBA{45, 45, 45, 255})
+	dc.SetFontFace(face)
+	dc.SetColor(titleColor)
 
 	// Calculate total text height
 	lineHeight := fontSize * 1.4
-	totalHeight := float64(len(lines)) * lineHeight
+	totalHeight := float64(len(lines))*lineHeight + subtitleHeight
 
-	// Starting Y position (center vertically, with room for footer)
-	startY := (float64(ogImageHeight)-totalHeight)/2 - 40
+	// Starting Y position (center vertically in the space above the footer)
+	startY := (float64(height) - r.footerHeight() - totalHeight) / 2
 
 	// Draw each line centered
 	for i, line := range lines {
 		y := startY + float64(i)*lineHeight + fontSize
-		dc.DrawStringAnchored(line, float64(ogImageWidth)/2, y, 0.5, 0.5)
+		dc.DrawStringAnchored(line, float64(width)/2, y, 0.5, 0.5)
+	}
+
+	// Draw the subtitle below the title in a lighter tone
+	if subtitleFace != nil {
+		dc.SetFontFace(subtitleFace)
+		dc.SetColor(withAlpha(titleColor, 200))
+		y := startY + float64(len(lines))*lineHeight + fontSize*0.3 + subtitleSize
+		dc.DrawStringAnchored(c.Subtitle, float64(width)/2, y, 0.5, 0.5)
 	}
 
 	// Draw footer with avatar, site name, and date
-	drawFooter(dc, f, p.Date.Format("2006-01-02"))
+	if err := r.drawFooter(dc, c.Date.Format(r.theme.Footer.DateFormat), footerColor); err != nil {
+		return nil, err
+	}
 
-	// Save image
-	outputPath := filepath.Join(outputDir, "ogp.png")
-	return dc.SavePNG(outputPath)
+	return dc.Image(), nil
 }
 
-func drawBackground(dc *gg.Context) {
-	// White background
-	dc.SetColor(color.RGBA{255, 255, 255, 255})
-	dc.Clear()
+// drawCover scales img to cover the canvas, cropping the overflow.
+func drawCover(dc *gg.Context, img image.Image) {
+	w, h := float64(dc.Width()), float64(dc.Height())
+	bounds := img.Bounds()
+	scale := math.Max(w/float64(bounds.Dx()), h/float64(bounds.Dy()))
+
+	dc.Push()
+	dc.Translate(w/2, h/2)
+	dc.Scale(scale, scale)
+	dc.DrawImageAnchored(img, 0, 0, 0.5, 0.5)
+	dc.Pop()
 }
 
-func drawFooter(dc *gg.Context, f *opentype.Font, date string) {
-	// Load avatar image
-	avatarImg, _, err := image.Decode(bytes.NewReader(avatarData))
-	if err != nil {
-		return
+// drawScrim darkens a cover photo so white text stays readable, more so
+// toward the bottom where the footer sits.
+func drawScrim(dc *gg.Context) {
+	w, h := float64(dc.Width()), float64(dc.Height())
+	scrim := gg.NewLinearGradient(0, 0, 0, h)
+	scrim.AddColorStop(0, color.NRGBA{0, 0, 0, 110})
+	scrim.AddColorStop(1, color.NRGBA{0, 0, 0, 190})
+	dc.SetFillStyle(scrim)
+	dc.DrawRectangle(0, 0, w, h)
+	dc.Fill()
+}
+
+func (r *ogRenderer) drawBackground(dc *gg.Context) {
+	w, h := float64(dc.Width()), float64(dc.Height())
+
+	switch {
+	case r.background != nil:
+		drawCover(dc, r.background)
+	case r.bgGradient != nil:
+		// Linear gradient through the center at the configured angle
+		angle := r.theme.Background.Angle * math.Pi / 180
+		dx, dy := math.Cos(angle)*w/2, math.Sin(angle)*h/2
+		gradient := gg.NewLinearGradient(w/2-dx, h/2-dy, w/2+dx, h/2+dy)
+		for i, c := range r.bgGradient {
+			gradient.AddColorStop(float64(i)/float64(len(r.bgGradient)-1), c)
+		}
+		dc.SetFillStyle(gradient)
+		dc.DrawRectangle(0, 0, w, h)
+		dc.Fill()
+	default:
+		dc.SetColor(r.bgColor)
+		dc.Clear()
 	}
+}
 
+// ogFooterFontSize is the size of the footer text. It also sets the gaps
+// between the avatar, the site name, the separator and the date.
+const ogFooterFontSize = 20
+
+// footerHeight is the space the footer takes at the bottom of the image,
+// from its top edge down to the bottom of the canvas.
+func (r *ogRenderer) footerHeight() float64 {
+	height := float64(ogFooterFontSize)
+	if r.avatar != nil {
+		height = math.Max(height, r.theme.Avatar.Size)
+	}
+	return r.theme.Padding.FooterBottom + height/2
+}
+
+func (r *ogRenderer) drawFooter(dc *gg.Context, date string, c color.RGBA) error {
 	// Footer layout (right-aligned): 2026-01-27 | mizzy.org [avatar]
-	avatarSize := 44.0
-	rightMargin := 60.0
-	avatarX := float64(ogImageWidth) - rightMargin - avatarSize/2
-	footerY := float64(ogImageHeight) - 55
-
-	// Scale avatar image to fit the circle
-	avatarDC := gg.NewContext(int(avatarSize), int(avatarSize))
-	avatarDC.DrawCircle(avatarSize/2, avatarSize/2, avatarSize/2)
-	avatarDC.Clip()
-	avatarDC.Scale(avatarSize/float64(avatarImg.Bounds().Dx()), avatarSize/float64(avatarImg.Bounds().Dy()))
-	avatarDC.DrawImage(avatarImg, 0, 0)
-
-	// Draw the circular avatar onto main context
-	dc.DrawImageAnchored(avatarDC.Image(), int(avatarX), int(footerY), 0.5, 0.5)
-
-	// Create smaller font for footer text
-	smallFace, err := opentype.NewFace(f, &opentype.FaceOptions{
-		Size:    20,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+	avatarSize := r.theme.Avatar.Size
+	footerX := float64(dc.Width()) - r.theme.Padding.FooterRight
+	footerY := float64(dc.Height()) - r.theme.Padding.FooterBottom
+	gap := float64(ogFooterFontSize)
+
+	if r.avatar != nil {
+		avatarX := footerX - avatarSize/2
+
+		// Scale avatar image to fit the shape
+		avatarDC := gg.NewContext(int(avatarSize), int(avatarSize))
+		switch r.theme.Avatar.Shape {
+		case "circle":
+			avatarDC.DrawCircle(avatarSize/2, avatarSize/2, avatarSize/2)
+			avatarDC.Clip()
+		case "rounded":
+			avatarDC.DrawRoundedRectangle(0, 0, avatarSize, avatarSize, avatarSize/5)
+			avatarDC.Clip()
+		}
+		avatarDC.Scale(avatarSize/float64(r.avatar.Bounds().Dx()), avatarSize/float64(r.avatar.Bounds().Dy()))
+		avatarDC.DrawImage(r.avatar, 0, 0)
+
+		// Draw the avatar onto main context
+		dc.DrawImageAnchored(avatarDC.Image(), int(avatarX), int(footerY), 0.5, 0.5)
+
+		footerX -= avatarSize + gap
+	}
+
+	smallFace, err := r.footerFonts.face(ogFooterFontSize)
 	if err != nil {
-		return
+		return err
 	}
 
 	dc.SetFontFace(smallFace)
 
-	// Adjust text Y position to align with avatar center (font baseline offset)
-	textY := footerY - 8
+	// Put the baseline half a cap height below the avatar center, so the
+	// text is centered on it
+	textY := footerY + float64(smallFace.Metrics().CapHeight)/64/2
 
 	// Draw site name to the left of avatar
-	dc.SetColor(color.RGBA{45, 45, 45, 220})
-	siteNameX := avatarX - avatarSize/2 - 20
-	dc.DrawStringAnchored("mizzy.org", siteNameX, textY, 1, 0.5)
-
-	// Draw separator between date and site name
-	dc.SetColor(color.RGBA{45, 45, 45, 100})
-	separatorX := siteNameX - 115
-	dc.DrawStringAnchored("|", separatorX, textY, 0.5, 0.5)
+	if r.theme.Footer.Text != "" {
+		dc.SetColor(withAlpha(c, 220))
+		dc.DrawStringAnchored(r.theme.Footer.Text, footerX, textY, 1, 0)
+
+		// Draw separator between date and site name
+		textWidth, _ := dc.MeasureString(r.theme.Footer.Text)
+		footerX -= textWidth + gap
+		dc.SetColor(withAlpha(c, 100))
+		dc.DrawStringAnchored("|", footerX, textY, 1, 0)
+		separatorWidth, _ := dc.MeasureString("|")
+		footerX -= separatorWidth + gap
+	}
 
 	// Draw date to the left of separator
-	dc.SetColor(color.RGBA{45, 45, 45, 180})
-	dc.DrawStringAnchored(date, separatorX-15, textY, 1, 0.5)
+	dc.SetColor(withAlpha(c, 180))
+	dc.DrawStringAnchored(date, footerX, textY, 1, 0)
+
+	return nil
 }
 
-func calculateFontSizeAndWrap(dc *gg.Context, f *opentype.Font, title string, maxWidth float64) (float64, []string, error) {
+// withAlpha scales the alpha of c by a/255.
+func withAlpha(c color.RGBA, a uint8) color.NRGBA {
+	return color.NRGBA{c.R, c.G, c.B, uint8(uint16(c.A) * uint16(a) / 255)}
+}
+
+// calculateFontSizeAndWrap picks the largest font size at which the title
+// fits in maxLines balanced lines, wrapping before shrinking.
+func calculateFontSizeAndWrap(dc *gg.Context, fonts fontChain, title string, maxWidth float64, maxLines int) (float64, []string, error) {
 	fontSizes := []float64{72, 60, 48, 40, 32, 28, 24, 20, 18}
-	maxLines := 1
 
 	for _, fontSize := range fontSizes {
-		face, err := opentype.NewFace(f, &opentype.FaceOptions{
-			Size:    fontSize,
-			DPI:     72,
-			Hinting: font.HintingFull,
-		})
+		face, err := fonts.face(fontSize)
 		if err != nil {
 			return 0, nil, err
 		}
 
 		dc.SetFontFace(face)
-		lines := wrapText(dc, title, maxWidth)
-
-		if len(lines) <= maxLines {
+		if lines, ok := wrapText(dc, title, maxWidth, maxLines); ok {
 			return fontSize, lines, nil
 		}
 	}
 
-	// Return smallest font size if still too many lines
+	// Use the smallest font size with as many lines as it takes
 	smallestSize := fontSizes[len(fontSizes)-1]
-	face, err := opentype.NewFace(f, &opentype.FaceOptions{
-		Size:    smallestSize,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+	face, err := fonts.face(smallestSize)
 	if err != nil {
 		return 0, nil, err
 	}
 	dc.SetFontFace(face)
-	lines := wrapText(dc, title, maxWidth)
-	return smallestSize, lines, nil
+	return smallestSize, greedyLines(dc, splitTextForWrapping(title), maxWidth), nil
 }
 
-func wrapText(dc *gg.Context, text string, maxWidth float64) []string {
+// wrapText breaks text into at most maxLines lines no wider than maxWidth,
+// using as few lines as possible and keeping them close to equal width.
+// It reports false if the text doesn't fit; the lines returned then may
+// overflow.
+func wrapText(dc *gg.Context, text string, maxWidth float64, maxLines int) ([]string, bool) {
 	totalWidth, _ := dc.MeasureString(text)
 	if totalWidth <= maxWidth {
-		return []string{text}
+		return []string{text}, true
 	}
 
-	words, needsSpace := splitTextForWrappingWithSpace(text)
-	bestSplitIdx := findBestSplitPoint(dc, words, needsSpace, totalWidth, maxWidth)
-	lines := buildLines(words, needsSpace, bestSplitIdx)
-
-	// If second line is still too long, recursively wrap it
-	if len(lines) == 2 {
-		secondWidth, _ := dc.MeasureString(lines[1])
-		if secondWidth > maxWidth {
-			subLines := wrapText(dc, lines[1], maxWidth)
-			lines = append([]string{lines[0]}, subLines...)
+	segments := splitTextForWrapping(text)
+	width := measureLines(dc, segments, maxWidth)
+	for n := 2; n <= maxLines && n <= len(segments); n++ {
+		if breaks, ok := findBestSplitPoints(segments, width, n, totalWidth/float64(n), maxWidth); ok {
+			return buildLines(segments, breaks), true
 		}
 	}
 
-	return lines
+	// Doesn't fit: put each unbreakable segment that overflows on its own line
+	return greedyLines(dc, segments, maxWidth), false
 }
 
-func findBestSplitPoint(dc *gg.Context, words []string, needsSpace []bool, totalWidth, maxWidth float64) int {
-	targetWidth := totalWidth / 2
-	bestSplitIdx := 0
-	bestScore := totalWidth * 10
-
-	var accumulated string
-	for i, word := range words {
-		if i > 0 && needsSpace[i] {
-			accumulated += " "
+// measureLines returns width[i][j], the width of the line made of
+// segments i..j-1. A line stops being measured once it overflows maxWidth;
+// the longer lines starting at the same segment are +Inf.
+func measureLines(dc *gg.Context, segments []string, maxWidth float64) [][]float64 {
+	count := len(segments)
+	width := make([][]float64, count+1)
+	for i := range width {
+		width[i] = make([]float64, count+1)
+		overflow := false
+		for j := i + 1; j <= count; j++ {
+			if overflow {
+				width[i][j] = math.Inf(1)
+				continue
+			}
+			width[i][j], _ = dc.MeasureString(joinSegments(segments[i:j]))
+			overflow = width[i][j] > maxWidth
 		}
-		accumulated += word
+	}
+	return width
+}
 
-		accWidth, _ := dc.MeasureString(accumulated)
-		if accWidth > maxWidth {
-			continue
+// findBestSplitPoints chooses where to break segments into n lines that
+// fit maxWidth, minimizing how far each line is from targetWidth plus
+// penalties for awkward break positions. width is the matrix from
+// measureLines. It returns the segment index each line after the first
+// starts at.
+func findBestSplitPoints(segments []string, width [][]float64, n int, targetWidth, maxWidth float64) ([]int, bool) {
+	count := len(segments)
+	inf := math.Inf(1)
+
+	// cost[k][j] is the best cost of putting segments 0..j-1 on k lines
+	cost := make([][]float64, n+1)
+	from := make([][]int, n+1)
+	for k := range cost {
+		cost[k] = make([]float64, count+1)
+		from[k] = make([]int, count+1)
+		for j := range cost[k] {
+			cost[k][j] = inf
 		}
-
-		score := calculateSplitScore(word, words, i, accWidth, targetWidth, totalWidth)
-		if score < bestScore {
-			bestScore = score
-			bestSplitIdx = i + 1
+	}
+	cost[0][0] = 0
+
+	for k := 1; k <= n; k++ {
+		for j := k; j <= count; j++ {
+			for i := k - 1; i < j; i++ {
+				if cost[k-1][i] == inf || width[i][j] > maxWidth {
+					continue
+				}
+
+				c := cost[k-1][i] + math.Abs(width[i][j]-targetWidth)
+				if j < count {
+					c += calculateSplitScore(segments, j, targetWidth)
+				}
+
+				if c < cost[k][j] {
+					cost[k][j] = c
+					from[k][j] = i
+				}
+			}
 		}
 	}
 
-	return bestSplitIdx
+	if cost[n][count] == inf {
+		return nil, false
+	}
+
+	breaks := make([]int, n-1)
+	j := count
+	for k := n; k > 1; k-- {
+		j = from[k][j]
+		breaks[k-2] = j
+	}
+
+	return breaks, true
 }
 
-func calculateSplitScore(word string, words []string, i int, accWidth, targetWidth, totalWidth float64) float64 {
-	diff := abs(accWidth - targetWidth)
-	score := diff
+// calculateSplitScore is the penalty for starting a line at segments[i].
+func calculateSplitScore(segments []string, i int, targetWidth float64) float64 {
+	before := []rune(joinSegments(segments[max(0, i-3):i]))
+	after := []rune(segments[i])
+	if len(before) == 0 || len(after) == 0 {
+		return 0
+	}
+
+	last, next := before[len(before)-1], after[0]
+	score := 0.0
 
 	// Bonus for splitting after particles (better word boundaries)
-	ratio := accWidth / totalWidth
-	if isJapaneseParticle(word) && ratio >= 0.3 && ratio <= 0.7 {
+	if isJapaneseParticle(string(before), next) {
 		score -= targetWidth * 0.5
 	}
 
-	// Penalty for splitting between consecutive kanji
-	if i+1 < len(words) && len(word) > 0 && len(words[i+1]) > 0 {
-		currentRunes := []rune(word)
-		nextRunes := []rune(words[i+1])
-		if isKanji(currentRunes[len(currentRunes)-1]) && isKanji(nextRunes[0]) {
-			score += targetWidth * 1.0
-		}
+	// Penalty for splitting inside a run of kanji or katakana
+	if isKanji(last) && isKanji(next) {
+		score += targetWidth * 1.0
+	}
+	if isKatakana(last) && isKatakana(next) {
+		score += targetWidth * 1.0
 	}
 
 	return score
 }
 
-func buildLines(words []string, needsSpace []bool, splitIdx int) []string {
+func buildLines(segments []string, breaks []int) []string {
 	var lines []string
-	var line1, line2 string
-
-	for i, word := range words {
-		if i < splitIdx {
-			if i > 0 && needsSpace[i] {
-				line1 += " "
-			}
-			line1 += word
-		} else {
-			if line2 != "" && needsSpace[i] {
-				line2 += " "
-			}
-			line2 += word
-		}
+	start := 0
+	for _, end := range append(breaks, len(segments)) {
+		lines = append(lines, joinSegments(segments[start:end]))
+		start = end
 	}
-
-	if line1 != "" {
-		lines = append(lines, line1)
-	}
-	if line2 != "" {
-		lines = append(lines, line2)
-	}
-
 	return lines
 }
 
-func isJapaneseParticle(s string) bool {
-	particles := []string{"に", "を", "は", "が", "で", "と", "へ", "の", "も", "や", "から", "まで", "より"}
-	for _, p := range particles {
-		if s == p {
-			return true
+func greedyLines(dc *gg.Context, segments []string, maxWidth float64) []string {
+	var lines []string
+	start := 0
+	for end := 1; end <= len(segments); end++ {
+		if end-start > 1 {
+			if w, _ := dc.MeasureString(joinSegments(segments[start:end])); w > maxWidth {
+				lines = append(lines, joinSegments(segments[start:end-1]))
+				start = end - 1
+			}
 		}
 	}
-	return false
+	return append(lines, joinSegments(segments[start:]))
 }
 
-func isKanji(r rune) bool {
-	// CJK Unified Ideographs
-	if r >= 0x4E00 && r <= 0x9FFF {
-		return true
-	}
-	// CJK Unified Ideographs Extension A
-	if r >= 0x3400 && r <= 0x4DBF {
-		return true
-	}
-	return false
+// joinSegments joins segments into a line, dropping the spaces at its end.
+func joinSegments(segments []string) string {
+	return strings.TrimRight(strings.Join(segments, ""), " ")
 }
 
-func abs(x float64) float64 {
-	if x < 0 {
-		return -x
+// isJapaneseParticle reports whether text ends with a particle that closes
+// a phrase, i.e. it is not followed by more hiragana.
+func isJapaneseParticle(text string, next rune) bool {
+	if isHiragana(next) {
+		return false
 	}
-	return x
-}
 
-func splitTextForWrappingWithSpace(text string) ([]string, []bool) {
-	var result []string
-	var needsSpace []bool
-	var current strings.Builder
-	lastWasCJK := false
-
-	for _, r := range text {
-		// Check if it's a CJK character (Japanese, Chinese, Korean)
-		if isCJK(r) {
-			if current.Len() > 0 {
-				result = append(result, current.String())
-				needsSpace = append(needsSpace, !lastWasCJK)
-				current.Reset()
-			}
-			result = append(result, string(r))
-			needsSpace = append(needsSpace, false) // No space before CJK
-			lastWasCJK = true
-		} else if r == ' ' {
-			if current.Len() > 0 {
-				result = append(result, current.String())
-				needsSpace = append(needsSpace, true)
-				current.Reset()
-			}
-			lastWasCJK = false
-		} else {
-			current.WriteRune(r)
-			lastWasCJK = false
+	particles := []string{"に", "を", "は", "が", "で", "と", "へ", "の", "も", "や", "から", "まで", "より"}
+	for _, p := range particles {
+		if strings.HasSuffix(text, p) {
+			return true
 		}
 	}
-
-	if current.Len() > 0 {
-		result = append(result, current.String())
-		needsSpace = append(needsSpace, !lastWasCJK)
-	}
-
-	// First element never needs leading space
-	if len(needsSpace) > 0 {
-		needsSpace[0] = false
-	}
-
-	return result, needsSpace
-}
-
-func isCJK(r rune) bool {
-	// CJK Unified Ideographs
-	if r >= 0x4E00 && r <= 0x9FFF {
-		return true
-	}
-	// Hiragana
-	if r >= 0x3040 && r <= 0x309F {
-		return true
-	}
-	// Katakana
-	if r >= 0x30A0 && r <= 0x30FF {
-		return true
-	}
-	// CJK Unified Ideographs Extension A
-	if r >= 0x3400 && r <= 0x4DBF {
-		return true
-	}
-	// CJK Symbols and Punctuation
-	if r >= 0x3000 && r <= 0x303F {
-		return true
-	}
-	// Halfwidth and Fullwidth Forms
-	if r >= 0xFF00 && r <= 0xFFEF {
-		return true
-	}
 	return false
 }
@@ -0,0 +1,75 @@
+package nebel
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+func newTestContext(t *testing.T, size float64) *gg.Context {
+	t.Helper()
+	fonts, err := loadFontChain(fstest.MapFS{}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, err := fonts.face(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc := gg.NewContext(1200, 630)
+	dc.SetFontFace(face)
+	return dc
+}
+
+func TestWrapText(t *testing.T) {
+	dc := newTestContext(t, 48)
+
+	lines, ok := wrapText(dc, "Short title", 1040, 2)
+	if !ok || len(lines) != 1 {
+		t.Errorf("wrapText(short) = %q, %v", lines, ok)
+	}
+
+	title := "Building a static site generator that renders Open Graph images for every post"
+	lines, ok = wrapText(dc, title, 1040, 3)
+	if !ok || len(lines) < 2 {
+		t.Fatalf("wrapText() = %q, %v", lines, ok)
+	}
+	if got := strings.Join(lines, " "); got != title {
+		t.Errorf("lines %q don't join back to the title", lines)
+	}
+	for _, line := range lines {
+		if w, _ := dc.MeasureString(line); w > 1040 {
+			t.Errorf("line %q is %.0f wide", line, w)
+		}
+	}
+}
+
+func TestCalculateFontSizeAndWrapLongTitle(t *testing.T) {
+	dc := gg.NewContext(1200, 630)
+	fonts, err := loadFontChain(fstest.MapFS{}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Far too long to fit at any size, so it falls back to greedy wrapping
+	title := strings.Repeat("a very long title ", 40)
+	start := time.Now()
+	size, lines, err := calculateFontSizeAndWrap(dc, fonts, title, 1040, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wrapping took %s", elapsed)
+	}
+	if size != 18 || len(lines) < 3 {
+		t.Errorf("got size %v with %d lines, want the smallest size on several lines", size, len(lines))
+	}
+	for _, line := range lines {
+		if w, _ := dc.MeasureString(line); w > 1040 {
+			t.Errorf("line %q is %.0f wide", line, w)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package nebel
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"sort"
+	"time"
+)
+
+// PreviewOGImage renders the OG image of the post file at postPath, or of
+// title when postPath is empty, and writes it to output. title also
+// overrides the post's title when both are given. An empty output or "-"
+// writes to stdout.
+func (s *Site) PreviewOGImage(postPath, title, output string) error {
+	if postPath == "" && title == "" {
+		return errors.New("og: a post file or a title is required")
+	}
+
+	config, err := loadConfig(s.Source)
+	if err != nil {
+		return err
+	}
+
+	og, err := newOGRenderer(s.Source, config.OG)
+	if err != nil {
+		return err
+	}
+
+	post := &Post{Date: time.Now()}
+	if postPath != "" {
+		data, err := readSourceFile(s.Source, postPath)
+		if err != nil {
+			return err
+		}
+		if post, err = parsePost(postPath, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	if title != "" {
+		post.Title = title
+		post.OGTitle = ""
+		post.OGImage = ""
+	}
+
+	data, _, err := post.ogImage(og)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(output, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteOGSheet writes an HTML page showing the OG image of every post,
+// newest first, with the images inlined so the page can be opened as is.
+func (s *Site) WriteOGSheet(output string) error {
+	config, err := loadConfig(s.Source)
+	if err != nil {
+		return err
+	}
+
+	og, err := newOGRenderer(s.Source, config.OG)
+	if err != nil {
+		return err
+	}
+
+	posts, err := createPostObjects(s.Source)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Date.After(posts[j].Date)
+	})
+
+	return writeOutput(output, func(w io.Writer) error {
+		fmt.Fprint(w, ogSheetHeader)
+		for _, post := range posts {
+			data, ext, err := post.ogImage(og)
+			if err != nil {
+				return fmt.Errorf("%s: %w", post.SourcePath, err)
+			}
+
+			fmt.Fprintf(w, "<figure><img src=\"data:%s;base64,%s\" alt=\"\" />\n",
+				mime.TypeByExtension(ext), base64.StdEncoding.EncodeToString(data))
+			fmt.Fprintf(w, "<figcaption>%s<br /><small>%s</small></figcaption></figure>\n",
+				html.EscapeString(post.Title), html.EscapeString(post.SourcePath))
+		}
+		_, err := fmt.Fprint(w, "</body>\n</html>\n")
+		return err
+	})
+}
+
+const ogSheetHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8" />
+<title>OG images</title>
+<style>
+body { display: flex; flex-wrap: wrap; gap: 24px; margin: 24px; font-family: sans-serif; background: #eee; }
+figure { margin: 0; }
+img { display: block; width: 600px; box-shadow: 0 1px 4px rgba(0, 0, 0, 0.2); }
+figcaption { max-width: 600px; margin-top: 8px; }
+</style>
+</head>
+<body>
+`
@@ -0,0 +1,124 @@
+package nebel
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Output receives the files of a built site. Names are slash-separated
+// paths relative to its root, such as blog/2024/01/02/1/index.html.
+type Output interface {
+	WriteFile(name string, data []byte) error
+	// ReadFile and Remove let a build read the manifest of the previous
+	// one and remove the files it no longer produces. ReadFile returns an
+	// error wrapping fs.ErrNotExist for a missing file.
+	ReadFile(name string) ([]byte, error)
+	Remove(name string) error
+}
+
+// DirOutput writes to a directory on disk, creating it as needed.
+type DirOutput string
+
+func (d DirOutput) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+func (d DirOutput) WriteFile(name string, data []byte) error {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+func (d DirOutput) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(d.path(name))
+}
+
+// Remove removes a file and then the directories above it that it leaves
+// empty.
+func (d DirOutput) Remove(name string) error {
+	if err := os.Remove(d.path(name)); err != nil {
+		return err
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if os.Remove(d.path(dir)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (d DirOutput) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.path(name))
+}
+
+// outputExists reports whether out has the file name. An Output with a
+// Stat method, such as DirOutput, is asked without reading the file.
+func outputExists(out Output, name string) bool {
+	if s, ok := out.(interface {
+		Stat(name string) (fs.FileInfo, error)
+	}); ok {
+		_, err := s.Stat(name)
+		return err == nil
+	}
+	_, err := out.ReadFile(name)
+	return err == nil
+}
+
+// MemoryOutput keeps the files in a map, e.g. to serve a site without
+// writing it or to inspect it in tests.
+type MemoryOutput map[string][]byte
+
+func (m MemoryOutput) WriteFile(name string, data []byte) error {
+	m[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m MemoryOutput) ReadFile(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (m MemoryOutput) Remove(name string) error {
+	if _, ok := m[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m, name)
+	return nil
+}
+
+// readSourceFile reads name from fsys. Absolute paths are passed on as
+// they are; a site on disk reads them from the file system, while other
+// sources reject them.
+func readSourceFile(fsys fs.FS, name string) ([]byte, error) {
+	if !filepath.IsAbs(name) {
+		name = path.Clean(filepath.ToSlash(name))
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+// writeOutput calls write with the file at path, or with stdout when path
+// is empty or "-".
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "" || path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+package nebel
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+type colorCount struct {
+	c     color.RGBA
+	count int
+}
+
+// colorBox is a set of colors split in two by median cut until there are
+// as many boxes as palette entries.
+type colorBox []colorCount
+
+func channel(c color.RGBA, i int) uint8 {
+	switch i {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	case 2:
+		return c.B
+	}
+	return c.A
+}
+
+// widest returns the channel with the largest range and that range.
+func (b colorBox) widest() (int, int) {
+	best, bestRange := 0, -1
+	for i := 0; i < 4; i++ {
+		lo, hi := 255, 0
+		for _, cc := range b {
+			v := int(channel(cc.c, i))
+			lo, hi = min(lo, v), max(hi, v)
+		}
+		if hi-lo > bestRange {
+			best, bestRange = i, hi-lo
+		}
+	}
+	return best, bestRange
+}
+
+// split divides b at the median pixel along its widest channel.
+func (b colorBox) split() (colorBox, colorBox) {
+	ch, _ := b.widest()
+	sort.Slice(b, func(i, j int) bool {
+		return channel(b[i].c, ch) < channel(b[j].c, ch)
+	})
+
+	total := 0
+	for _, cc := range b {
+		total += cc.count
+	}
+
+	seen := 0
+	for i, cc := range b {
+		seen += cc.count
+		if seen*2 >= total {
+			// Both halves must keep at least one color
+			i = max(1, min(i, len(b)-1))
+			return b[:i], b[i:]
+		}
+	}
+	return b[:len(b)-1], b[len(b)-1:]
+}
+
+func (b colorBox) average() color.RGBA {
+	var r, g, bl, a, total int
+	for _, cc := range b {
+		r += int(cc.c.R) * cc.count
+		g += int(cc.c.G) * cc.count
+		bl += int(cc.c.B) * cc.count
+		a += int(cc.c.A) * cc.count
+		total += cc.count
+	}
+	return color.RGBA{uint8(r / total), uint8(g / total), uint8(bl / total), uint8(a / total)}
+}
+
+// quantize reduces img to a palette of at most n colors chosen by median
+// cut, dithering so gradients don't band.
+func quantize(img image.Image, n int) *image.Paletted {
+	bounds := img.Bounds()
+
+	counts := map[color.RGBA]int{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			counts[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)]++
+		}
+	}
+
+	var all colorBox
+	for c, count := range counts {
+		all = append(all, colorCount{c, count})
+	}
+
+	boxes := []colorBox{all}
+	for len(boxes) < n {
+		// Split the box spanning the widest range of any channel
+		pick, pickRange := -1, 0
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if _, r := b.widest(); r > pickRange {
+				pick, pickRange = i, r
+			}
+		}
+		if pick < 0 {
+			break
+		}
+
+		a, b := boxes[pick].split()
+		boxes[pick] = a
+		boxes = append(boxes, b)
+	}
+
+	palette := make(color.Palette, len(boxes))
+	for i, b := range boxes {
+		palette[i] = b.average()
+	}
+
+	paletted := image.NewPaletted(bounds, palette)
+	draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
+	return paletted
+}
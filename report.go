@@ -0,0 +1,236 @@
+package nebel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Build phases, in the order they run. They name where a BuildError
+// happened and what the build report times.
+const (
+	PhaseConfig   = "config"
+	PhaseParse    = "parse"
+	PhaseRender   = "render"
+	PhaseTemplate = "template"
+	PhaseOG       = "og"
+	PhaseCopy     = "copy"
+	PhasePrune    = "prune"
+)
+
+// BuildError is a build failure with the phase and, when there is one, the
+// file it happened in.
+type BuildError struct {
+	Phase string
+	File  string
+	Err   error
+}
+
+func (e *BuildError) Error() string {
+	if e.File == "" {
+		return e.Phase + ": " + e.Err.Error()
+	}
+	return e.Phase + ": " + e.File + ": " + e.Err.Error()
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// buildError wraps err in a BuildError unless it already is one.
+func buildError(phase, file string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var be *BuildError
+	if errors.As(err, &be) {
+		return err
+	}
+	return &BuildError{Phase: phase, File: file, Err: err}
+}
+
+// Exit codes of nebel: 1 for errors outside a build, 2 for usage errors and
+// one per build phase from 3.
+var phaseExitCodes = map[string]int{
+	PhaseConfig:   3,
+	PhaseParse:    4,
+	PhaseRender:   5,
+	PhaseTemplate: 6,
+	PhaseOG:       7,
+	PhaseCopy:     8,
+	PhasePrune:    9,
+}
+
+// ExitCode is the exit status nebel uses for err.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var be *BuildError
+	if errors.As(err, &be) {
+		if code, ok := phaseExitCodes[be.Phase]; ok {
+			return code
+		}
+	}
+	return 1
+}
+
+// BuildReport describes a build, for the summary and --report.
+type BuildReport struct {
+	Started  time.Time     `json:"started"`
+	Duration float64       `json:"duration_seconds"`
+	Phases   []PhaseTiming `json:"phases"`
+	Posts    int           `json:"posts"`
+	// Pages counts HTML pages and feeds, Images OG images and Files
+	// static files.
+	Pages    int      `json:"pages"`
+	Images   int      `json:"images"`
+	Files    int      `json:"files"`
+	Warnings []string `json:"warnings"`
+	// Removed are stale files deleted from the output, or that would be
+	// with --dry-run.
+	Removed []string     `json:"removed"`
+	Error   *ReportError `json:"error,omitempty"`
+}
+
+type PhaseTiming struct {
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration_seconds"`
+}
+
+type ReportError struct {
+	Phase   string `json:"phase,omitempty"`
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+// buildLog prints the progress of a build and collects its report.
+// Warnings are printed unless quiet; written files only when verbose.
+type buildLog struct {
+	out     io.Writer
+	verbose bool
+	quiet   bool
+	// dryRun reports stale files instead of removing them.
+	dryRun bool
+	report BuildReport
+	// outputs are the names of the files the build produced.
+	outputs map[string]bool
+	// previous is the manifest of the last build, and sums the hashes
+	// this build records for the next one.
+	previous *manifest
+	sums     map[string]string
+}
+
+func newBuildLog(verbose, quiet bool) *buildLog {
+	return &buildLog{
+		out:      os.Stderr,
+		verbose:  verbose,
+		quiet:    quiet,
+		report:   BuildReport{Started: time.Now(), Warnings: []string{}, Removed: []string{}},
+		outputs:  map[string]bool{},
+		previous: &manifest{},
+		sums:     map[string]string{},
+	}
+}
+
+// phase runs fn as the named phase, timing it and wrapping its error.
+func (l *buildLog) phase(name string, fn func() error) error {
+	if l.verbose {
+		fmt.Fprintf(l.out, "%s...\n", name)
+	}
+	start := time.Now()
+	err := fn()
+	l.report.Phases = append(l.report.Phases, PhaseTiming{Name: name, Duration: time.Since(start).Seconds()})
+	return buildError(name, "", err)
+}
+
+func (l *buildLog) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	l.report.Warnings = append(l.report.Warnings, msg)
+	if !l.quiet {
+		fmt.Fprintln(l.out, "warning: "+msg)
+	}
+}
+
+func (l *buildLog) wrote(count *int, name string) {
+	*count++
+	l.keep(name)
+	if l.verbose {
+		fmt.Fprintln(l.out, "wrote", name)
+	}
+}
+
+// keep records an output file the build owns without writing it, such as
+// the unchanged page of an older post.
+func (l *buildLog) keep(name string) {
+	l.outputs[name] = true
+}
+
+func (l *buildLog) removed(name string) {
+	l.report.Removed = append(l.report.Removed, name)
+	switch {
+	case l.quiet:
+	case l.dryRun:
+		fmt.Fprintln(l.out, "would remove", name)
+	default:
+		fmt.Fprintln(l.out, "removed", name)
+	}
+}
+
+func (l *buildLog) page(name string)  { l.wrote(&l.report.Pages, name) }
+func (l *buildLog) image(name string) { l.wrote(&l.report.Images, name) }
+func (l *buildLog) file(name string)  { l.wrote(&l.report.Files, name) }
+
+// finish completes the report with the build's result and prints the
+// summary.
+func (l *buildLog) finish(err error) {
+	l.report.Duration = time.Since(l.report.Started).Seconds()
+
+	if err != nil {
+		l.report.Error = &ReportError{Message: err.Error()}
+		var be *BuildError
+		if errors.As(err, &be) {
+			l.report.Error = &ReportError{Phase: be.Phase, File: be.File, Message: be.Err.Error()}
+		}
+		return
+	}
+	if l.quiet {
+		return
+	}
+
+	r := l.report
+	fmt.Fprintf(l.out, "built %d posts: %d pages, %d OG images, %d static files in %s",
+		r.Posts, r.Pages, r.Images, r.Files, seconds(r.Duration))
+	if len(r.Removed) > 0 && l.dryRun {
+		fmt.Fprintf(l.out, ", %d stale files to remove", len(r.Removed))
+	} else if len(r.Removed) > 0 {
+		fmt.Fprintf(l.out, ", %d stale files removed", len(r.Removed))
+	}
+	if len(r.Warnings) > 0 {
+		fmt.Fprintf(l.out, " with %d warnings", len(r.Warnings))
+	}
+	fmt.Fprintln(l.out)
+
+	var timings []string
+	for _, p := range r.Phases {
+		timings = append(timings, p.Name+" "+seconds(p.Duration))
+	}
+	fmt.Fprintln(l.out, "  "+strings.Join(timings, ", "))
+}
+
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// writeReport writes the report as JSON to path, or stdout for "-".
+func (l *buildLog) writeReport(path string) error {
+	return writeOutput(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(l.report)
+	})
+}
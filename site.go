@@ -0,0 +1,172 @@
+package nebel
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Site builds a site from its sources into an Output. Source holds what a
+// site directory does: config.yaml, posts/, and optionally layouts/,
+// static/, lexers/ and data/linkcards.json.
+type Site struct {
+	Source fs.FS
+	Output Output
+
+	// LinkCards fetches the metadata of links missing from
+	// data/linkcards.json; links aren't fetched when it's nil, so a build
+	// doesn't go to the network unless asked to.
+	LinkCards LinkCardFetcher
+	// LinkCardCache is the file on disk newly fetched link cards are
+	// saved to. They're only kept for the build when it's empty.
+	LinkCardCache string
+
+	// Dir is the site's directory on disk, which CreateNewPost writes to.
+	// It's empty for a site that isn't on disk.
+	Dir string
+}
+
+// NewSite returns the site in dir, built into dir/public.
+func NewSite(dir string) *Site {
+	return &Site{
+		Source:        siteDir{os.DirFS(dir)},
+		Output:        DirOutput(filepath.Join(dir, "public")),
+		LinkCardCache: filepath.Join(dir, linkCardCachePath),
+		Dir:           dir,
+	}
+}
+
+// siteDir is the Source of a site on disk. Unlike os.DirFS it also reads
+// absolute paths, such as a system font named in config.yaml.
+type siteDir struct {
+	fs.FS
+}
+
+func (d siteDir) ReadFile(name string) ([]byte, error) {
+	if filepath.IsAbs(name) {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(d.FS, name)
+}
+
+// BuildOptions control what a build prints and reports.
+type BuildOptions struct {
+	// Verbose prints each phase and file written; Quiet prints nothing
+	// but errors.
+	Verbose bool
+	Quiet   bool
+	// Report is a file to write the JSON build report to, - for stdout.
+	// It's written when the build fails too.
+	Report string
+	// DryRun lists the stale files in the output instead of removing
+	// them.
+	DryRun bool
+}
+
+// Build builds the site and returns its report. Errors are BuildErrors
+// naming the phase and file that failed.
+func (s *Site) Build(opts BuildOptions) (*BuildReport, error) {
+	log := newBuildLog(opts.Verbose, opts.Quiet)
+	log.dryRun = opts.DryRun
+	err := s.build(log)
+	log.finish(err)
+
+	if opts.Report != "" {
+		if reportErr := log.writeReport(opts.Report); reportErr != nil && err == nil {
+			err = reportErr
+		}
+	}
+	return &log.report, err
+}
+
+func (s *Site) build(log *buildLog) error {
+	var config *Config
+	var siteLexers lexerSet
+	err := log.phase(PhaseConfig, func() error {
+		var err error
+		if config, err = loadConfig(s.Source); err != nil {
+			return err
+		}
+		siteLexers, err = loadSiteLexers(s.Source)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var posts []*Post
+	err = log.phase(PhaseParse, func() error {
+		all, err := loadPosts(s.Source)
+		posts = publishedPosts(all)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.report.Posts = len(posts)
+
+	err = log.phase(PhaseRender, func() error {
+		linkCards, err := loadLinkCardCache(s.Source, s.LinkCardCache, s.LinkCards)
+		if err != nil {
+			return buildError(PhaseRender, linkCardCachePath, err)
+		}
+		linkCards.warn = log.warnf
+
+		if err := processPosts(posts, config, newMarkdown(config, siteLexers, linkCards)); err != nil {
+			return err
+		}
+
+		return buildError(PhaseRender, s.LinkCardCache, linkCards.save())
+	})
+	if err != nil {
+		return err
+	}
+
+	err = log.phase(PhaseTemplate, func() error {
+		// The last build's manifest tells which older posts are unchanged
+		previous, err := loadManifest(s.Output)
+		if err != nil {
+			return buildError(PhaseTemplate, manifestName, err)
+		}
+		log.previous = previous
+
+		if err := writePostFiles(s.Source, s.Output, posts, config, log); err != nil {
+			return err
+		}
+		if err := writeRedirects(s.Output, posts, config, log); err != nil {
+			return err
+		}
+		if err := generateIndexHTML(s.Source, s.Output, posts, config, log); err != nil {
+			return err
+		}
+		return generateAtomXML(s.Source, s.Output, posts, config, log)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = log.phase(PhaseOG, func() error {
+		og, err := newOGRenderer(s.Source, config.OG)
+		if err != nil {
+			return buildError(PhaseOG, configPath, err)
+		}
+		return writeOGImages(s.Output, posts, config, og, log)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = log.phase(PhaseCopy, func() error {
+		if err := generateChromaCSS(s.Output, config, siteLexers, log); err != nil {
+			return err
+		}
+		return copyStaticFiles(s.Source, s.Output, log)
+	})
+	if err != nil {
+		return err
+	}
+
+	return log.phase(PhasePrune, func() error {
+		return pruneOutputs(s.Output, log)
+	})
+}
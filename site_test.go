@@ -0,0 +1,123 @@
+package nebel
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+const testLexerXML = `<lexer>
+  <config>
+    <name>Foo</name>
+    <alias>foo</alias>
+  </config>
+  <rules>
+    <state name="root">
+      <rule pattern="\bfoo\b"><token type="Keyword"/></rule>
+      <rule pattern="\s+"><token type="Text"/></rule>
+      <rule pattern="."><token type="Text"/></rule>
+    </state>
+  </rules>
+</lexer>
+`
+
+func TestSiteBuild(t *testing.T) {
+	src := testSite(2)
+	src["posts/2024-01-02-post-2.markdown"].Data = []byte("---\ntitle: Code\ndate: 2024-01-02 10:00:00 +0900\n---\n\n```foo\nfoo bar\n```\n")
+	src["lexers/foo.xml"] = &fstest.MapFile{Data: []byte(testLexerXML)}
+	src["static/robots.txt"] = &fstest.MapFile{Data: []byte("User-agent: *\n")}
+	src["static/css/style.css"] = &fstest.MapFile{Data: []byte("body {}\n")}
+
+	out := MemoryOutput{}
+	report, err := (&Site{Source: src, Output: out}).Build(BuildOptions{Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Posts != 2 {
+		t.Errorf("built %d posts, want 2", report.Posts)
+	}
+	// chroma.css, robots.txt and the overridden style.css, counted once
+	if report.Files != 3 {
+		t.Errorf("copied %d files, want 3", report.Files)
+	}
+	if css := string(out["css/style.css"]); css != "body {}\n" {
+		t.Errorf("the site's style.css was overwritten:\n%s", css)
+	}
+
+	for _, name := range []string{
+		"index.html", "ogp.png", "atom.xml", "css/chroma.css", "css/style.css", "robots.txt",
+		"blog/2024/01/01/1/index.html", "blog/2024/01/01/1/ogp.png",
+		"blog/2024/01/02/1/index.html", "blog/2024/01/02/1/ogp.png",
+		manifestName,
+	} {
+		if _, ok := out[name]; !ok {
+			t.Errorf("%s wasn't written", name)
+		}
+	}
+
+	page := string(out["blog/2024/01/02/1/index.html"])
+	if !strings.Contains(page, `<span class="k">foo</span>`) {
+		t.Errorf("the site's lexer wasn't used:\n%s", page)
+	}
+
+	// The lexer belongs to the site, not to every build in the process
+	if lexers.Get("foo") != nil {
+		t.Error("the site's lexer was registered with Chroma")
+	}
+	delete(src, "lexers/foo.xml")
+	out = MemoryOutput{}
+	if _, err := (&Site{Source: src, Output: out}).Build(BuildOptions{Quiet: true}); err != nil {
+		t.Fatal(err)
+	}
+	if page := string(out["blog/2024/01/02/1/index.html"]); strings.Contains(page, `<span class="k">`) {
+		t.Errorf("another site's lexer was used:\n%s", page)
+	}
+}
+
+func TestSiteBuildReadsOnlySource(t *testing.T) {
+	src := testSite(1)
+	src["config.yaml"].Data = append(src["config.yaml"].Data, "  font: /etc/hostname\n"...)
+
+	_, err := (&Site{Source: src, Output: MemoryOutput{}}).Build(BuildOptions{Quiet: true})
+	var be *BuildError
+	if !errors.As(err, &be) || be.Phase != PhaseOG {
+		t.Errorf("Build() = %v, want an og error for a font outside the source", err)
+	}
+}
+
+func TestCreateNewPostWithoutDir(t *testing.T) {
+	site := &Site{Source: testSite(0), Output: MemoryOutput{}}
+	if _, err := site.CreateNewPost("Title", NewPostOptions{}); err == nil {
+		t.Error("CreateNewPost() succeeded for a site without a directory")
+	}
+}
+
+func TestCreateNewPostNumbersTimeSlug(t *testing.T) {
+	dir := writeTestSite(t, testSite(0))
+	if err := os.Mkdir(filepath.Join(dir, "posts"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	site := NewSite(dir)
+
+	for _, want := range []string{"2024-02-03-000000", "2024-02-03-000000-2", "2024-02-03-000000-3"} {
+		path, err := site.CreateNewPost("日本語のタイトル", NewPostOptions{Date: "2024-02-03"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(filepath.Base(path), ".markdown"); got != want {
+			t.Errorf("CreateNewPost() wrote %s, want %s", got, want)
+		}
+	}
+
+	if _, err := site.CreateNewPost("Hello", NewPostOptions{Date: "2024-02-03"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := site.CreateNewPost("Hello", NewPostOptions{Date: "2024-02-03"}); err == nil {
+		t.Error("CreateNewPost() overwrote or renamed a post with a title slug")
+	}
+}
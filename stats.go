@@ -0,0 +1,246 @@
+package nebel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// How many posts are listed as the longest and the shortest.
+const statsPostCount = 5
+
+type siteStats struct {
+	Posts          int           `json:"posts"`
+	First          time.Time     `json:"first"`
+	Last           time.Time     `json:"last"`
+	Chars          int           `json:"chars"`
+	Words          int           `json:"words"`
+	LatinWords     int           `json:"latin_words"`
+	CJKChars       int           `json:"cjk_chars"`
+	ReadingMinutes int           `json:"reading_minutes"`
+	PerYear        []periodCount `json:"per_year"`
+	PerMonth       []periodCount `json:"per_month"`
+	Tags           []tagCount    `json:"tags"`
+	Longest        []postSize    `json:"longest"`
+	Shortest       []postSize    `json:"shortest"`
+	Gaps           gapStats      `json:"gaps"`
+}
+
+type periodCount struct {
+	Period string `json:"period"`
+	Posts  int    `json:"posts"`
+}
+
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Posts int    `json:"posts"`
+}
+
+type postSize struct {
+	Title          string    `json:"title"`
+	Path           string    `json:"path"`
+	Date           time.Time `json:"date"`
+	Chars          int       `json:"chars"`
+	Words          int       `json:"words"`
+	ReadingMinutes int       `json:"reading_minutes"`
+}
+
+// gapStats are the days between consecutive posts.
+type gapStats struct {
+	AverageDays   float64   `json:"average_days"`
+	MedianDays    float64   `json:"median_days"`
+	LongestDays   float64   `json:"longest_days"`
+	LongestFrom   *postSize `json:"longest_from,omitempty"`
+	LongestTo     *postSize `json:"longest_to,omitempty"`
+	SinceLastDays float64   `json:"since_last_days"`
+}
+
+// PrintStats prints statistics about the published posts, as text or as
+// JSON.
+func (s *Site) PrintStats(asJSON bool) error {
+	posts, err := loadPosts(s.Source)
+	if err != nil {
+		return err
+	}
+	posts = publishedPosts(posts)
+	if len(posts) == 0 {
+		return fmt.Errorf("no posts")
+	}
+
+	stats := collectStats(posts, time.Now())
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	return stats.write(os.Stdout)
+}
+
+// collectStats summarizes posts, which must be sorted by date.
+func collectStats(posts []*Post, now time.Time) *siteStats {
+	stats := &siteStats{
+		Posts: len(posts),
+		First: posts[0].Date,
+		Last:  posts[len(posts)-1].Date,
+		Tags:  []tagCount{},
+	}
+
+	years := map[string]int{}
+	months := map[string]int{}
+	tags := map[string]int{}
+	var sizes []postSize
+	for _, post := range posts {
+		prose := countProse(post.RawContent)
+		stats.Chars += prose.Chars
+		stats.LatinWords += prose.LatinWords
+		stats.CJKChars += prose.CJKChars
+
+		years[post.Date.Format("2006")]++
+		months[post.Date.Format("2006-01")]++
+		for _, tag := range post.Tags {
+			tags[tag]++
+		}
+
+		sizes = append(sizes, postSize{
+			Title:          post.Title,
+			Path:           post.Path,
+			Date:           post.Date,
+			Chars:          prose.Chars,
+			Words:          post.WordCount,
+			ReadingMinutes: post.ReadingTime,
+		})
+	}
+	total := proseCount{Chars: stats.Chars, LatinWords: stats.LatinWords, CJKChars: stats.CJKChars}
+	stats.Words = total.Words()
+	stats.ReadingMinutes = total.ReadingMinutes()
+
+	stats.PerYear = sortedPeriods(years)
+	stats.PerMonth = sortedPeriods(months)
+
+	for tag, n := range tags {
+		stats.Tags = append(stats.Tags, tagCount{tag, n})
+	}
+	sort.Slice(stats.Tags, func(i, j int) bool {
+		if stats.Tags[i].Posts != stats.Tags[j].Posts {
+			return stats.Tags[i].Posts > stats.Tags[j].Posts
+		}
+		return stats.Tags[i].Tag < stats.Tags[j].Tag
+	})
+
+	stats.Gaps = collectGaps(sizes, now)
+
+	bySize := append([]postSize(nil), sizes...)
+	sort.SliceStable(bySize, func(i, j int) bool {
+		return bySize[i].Words > bySize[j].Words
+	})
+	n := min(statsPostCount, len(bySize))
+	stats.Longest = bySize[:n]
+	for i := len(bySize) - 1; i >= len(bySize)-n; i-- {
+		stats.Shortest = append(stats.Shortest, bySize[i])
+	}
+
+	return stats
+}
+
+func sortedPeriods(counts map[string]int) []periodCount {
+	var periods []periodCount
+	for period, n := range counts {
+		periods = append(periods, periodCount{period, n})
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Period < periods[j].Period
+	})
+	return periods
+}
+
+func collectGaps(posts []postSize, now time.Time) gapStats {
+	var gaps gapStats
+	gaps.SinceLastDays = days(now.Sub(posts[len(posts)-1].Date))
+	if len(posts) < 2 {
+		return gaps
+	}
+
+	var all []float64
+	for i := 1; i < len(posts); i++ {
+		gap := days(posts[i].Date.Sub(posts[i-1].Date))
+		all = append(all, gap)
+		if gap > gaps.LongestDays {
+			gaps.LongestDays = gap
+			gaps.LongestFrom = &posts[i-1]
+			gaps.LongestTo = &posts[i]
+		}
+	}
+
+	sum := 0.0
+	for _, gap := range all {
+		sum += gap
+	}
+	gaps.AverageDays = sum / float64(len(all))
+
+	sort.Float64s(all)
+	if len(all)%2 == 1 {
+		gaps.MedianDays = all[len(all)/2]
+	} else {
+		gaps.MedianDays = (all[len(all)/2-1] + all[len(all)/2]) / 2
+	}
+
+	return gaps
+}
+
+func days(d time.Duration) float64 {
+	return d.Hours() / 24
+}
+
+func (s *siteStats) write(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Posts:\t%d (%s to %s)\n", s.Posts, s.First.Format("2006-01-02"), s.Last.Format("2006-01-02"))
+	fmt.Fprintf(w, "Characters:\t%d\n", s.Chars)
+	fmt.Fprintf(w, "Words:\t%d (%d Latin words, %d CJK characters; %d a post)\n", s.Words, s.LatinWords, s.CJKChars, s.Words/s.Posts)
+	fmt.Fprintf(w, "Reading time:\t%d min\n", s.ReadingMinutes)
+
+	fmt.Fprintln(w, "\nPosts per year")
+	for _, p := range s.PerYear {
+		fmt.Fprintf(w, "  %s\t%d\n", p.Period, p.Posts)
+	}
+
+	fmt.Fprintln(w, "\nPosts per month")
+	for _, p := range s.PerMonth {
+		fmt.Fprintf(w, "  %s\t%d\n", p.Period, p.Posts)
+	}
+
+	if len(s.Tags) > 0 {
+		fmt.Fprintln(w, "\nTags")
+		for _, t := range s.Tags {
+			fmt.Fprintf(w, "  %s\t%d\n", t.Tag, t.Posts)
+		}
+	}
+
+	fmt.Fprintln(w, "\nLongest posts")
+	writePostSizes(w, s.Longest)
+	fmt.Fprintln(w, "\nShortest posts")
+	writePostSizes(w, s.Shortest)
+
+	fmt.Fprintln(w, "\nGaps between posts")
+	fmt.Fprintf(w, "  Average:\t%.1f days\n", s.Gaps.AverageDays)
+	fmt.Fprintf(w, "  Median:\t%.1f days\n", s.Gaps.MedianDays)
+	if s.Gaps.LongestFrom != nil {
+		fmt.Fprintf(w, "  Longest:\t%.1f days, %s to %s\n", s.Gaps.LongestDays,
+			s.Gaps.LongestFrom.Date.Format("2006-01-02"), s.Gaps.LongestTo.Date.Format("2006-01-02"))
+	}
+	fmt.Fprintf(w, "  Since the last post:\t%.1f days\n", s.Gaps.SinceLastDays)
+
+	return w.Flush()
+}
+
+func writePostSizes(w io.Writer, sizes []postSize) {
+	for _, p := range sizes {
+		fmt.Fprintf(w, "  %d words\t%d min\t%s\t%s\t%s\n", p.Words, p.ReadingMinutes, p.Date.Format("2006-01-02"), p.Title, p.Path)
+	}
+}
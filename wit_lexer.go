@@ -2,11 +2,10 @@ package nebel
 
 import (
 	"github.com/alecthomas/chroma/v2"
-	"github.com/alecthomas/chroma/v2/lexers"
 )
 
 func init() {
-	lexers.Register(chroma.MustNewLexer(
+	registerCustomLexer(chroma.MustNewLexer(
 		&chroma.Config{
 			Name:      "WIT",
 			Aliases:   []string{"wit"},
@@ -17,37 +16,55 @@ func init() {
 			return chroma.Rules{
 				"root": {
 					// Comments
+					{Pattern: `///.*$`, Type: chroma.LiteralStringDoc, Mutator: nil},
 					{Pattern: `//.*$`, Type: chroma.Comment, Mutator: nil},
 					{Pattern: `/\*`, Type: chroma.CommentMultiline, Mutator: chroma.Push("comment")},
 
-					// Keywords
-					{Pattern: `\b(interface|world|import|export|use|func|type|record|variant|enum|flags|resource|package|include)\b`, Type: chroma.Keyword, Mutator: nil},
+					// Feature gates (@since, @unstable, @deprecated)
+					{Pattern: `@(since|unstable|deprecated)\b`, Type: chroma.NameDecorator, Mutator: nil},
+
+					// Package paths (e.g., wasi:http/outgoing-handler@0.2.0-rc-2023-11-10)
+					{Pattern: `%?[a-z][a-z0-9-]*:%?[a-z][a-z0-9-]*(/%?[a-z][a-z0-9-]*)*(@[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?)?`, Type: chroma.NameNamespace, Mutator: nil},
+
+					// %-escaped identifiers, which may spell a keyword
+					{Pattern: `%[a-zA-Z][a-zA-Z0-9-]*(?=\s*:)`, Type: chroma.NameAttribute, Mutator: nil},
+					{Pattern: `%[a-zA-Z][a-zA-Z0-9-]*`, Type: chroma.NameVariable, Mutator: nil},
+
+					// Names introduced by a type or interface declaration
+					{Pattern: `(record|variant|enum|flags|resource|type)(\s+)([a-zA-Z][a-zA-Z0-9-]*)`, Type: chroma.ByGroups(chroma.Keyword, chroma.Text, chroma.NameClass), Mutator: nil},
+					{Pattern: `(interface|world)(\s+)([a-zA-Z][a-zA-Z0-9-]*)`, Type: chroma.ByGroups(chroma.Keyword, chroma.Text, chroma.NameNamespace), Mutator: nil},
+
+					// Field/param names before colon
+					{Pattern: `[a-z][a-zA-Z0-9-]*(?=\s*:)`, Type: chroma.NameAttribute, Mutator: nil},
+
+					// Keywords (identifiers are kebab-case, so `-` is part of a word)
+					{Pattern: `(?<![\w-])(interface|world|import|export|use|func|type|record|variant|enum|flags|resource|package|include|constructor|static|async|as|with)(?![\w-])`, Type: chroma.Keyword, Mutator: nil},
 
 					// Built-in types
-					{Pattern: `\b(bool|s8|s16|s32|s64|u8|u16|u32|u64|f32|f64|char|string|list|option|result|tuple)\b`, Type: chroma.KeywordType, Mutator: nil},
+					{Pattern: `(?<![\w-])(bool|s8|s16|s32|s64|u8|u16|u32|u64|f32|f64|float32|float64|char|string|list|option|result|tuple|own|borrow|stream|future|error-context)(?![\w-])`, Type: chroma.KeywordType, Mutator: nil},
 
 					// Booleans
-					{Pattern: `\b(true|false)\b`, Type: chroma.KeywordConstant, Mutator: nil},
+					{Pattern: `(?<![\w-])(true|false)(?![\w-])`, Type: chroma.KeywordConstant, Mutator: nil},
 
 					// Strings
 					{Pattern: `"`, Type: chroma.StringDouble, Mutator: chroma.Push("string")},
 
+					// Versions in feature gates (e.g., @since(version = 0.2.1))
+					{Pattern: `\b[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?`, Type: chroma.LiteralNumber, Mutator: nil},
+
 					// Numbers
 					{Pattern: `\b[0-9]+\b`, Type: chroma.NumberInteger, Mutator: nil},
 
 					// Operators and punctuation
 					{Pattern: `->`, Type: chroma.Operator, Mutator: nil},
-					{Pattern: `[{}()\[\],;:=<>.]`, Type: chroma.Punctuation, Mutator: nil},
+					{Pattern: `[{}()\[\],;:=<>.*/@]`, Type: chroma.Punctuation, Mutator: nil},
 
-					// Package paths (e.g., wasi:http/outgoing-handler@0.2.0)
-					{Pattern: `[a-z][a-z0-9-]*:[a-z][a-z0-9-]*/[a-z][a-z0-9-]*(@[0-9.]+)?`, Type: chroma.NameNamespace, Mutator: nil},
+					// Type names (PascalCase, as written in bindings and prose)
+					{Pattern: `[A-Z][a-zA-Z0-9]*(-[a-zA-Z0-9]+)*`, Type: chroma.NameClass, Mutator: nil},
 
-					// Field/param names before colon
-					{Pattern: `[a-z][a-z0-9-]*(?=\s*:)`, Type: chroma.NameAttribute, Mutator: nil},
-
-					// Type names (PascalCase or kebab-case starting with lowercase)
-					{Pattern: `_\b`, Type: chroma.NameBuiltin, Mutator: nil},
-					{Pattern: `[a-z][a-z0-9-]*`, Type: chroma.NameVariable, Mutator: nil},
+					// Identifiers (kebab-case, with optional all-caps acronym segments)
+					{Pattern: `_(?![\w-])`, Type: chroma.NameBuiltin, Mutator: nil},
+					{Pattern: `[a-z][a-zA-Z0-9-]*`, Type: chroma.NameVariable, Mutator: nil},
 
 					// Whitespace
 					{Pattern: `\s+`, Type: chroma.Text, Mutator: nil},
@@ -57,10 +74,12 @@ func init() {
 					{Pattern: `"`, Type: chroma.StringDouble, Mutator: chroma.Pop(1)},
 					{Pattern: `[^"\\]+`, Type: chroma.StringDouble, Mutator: nil},
 				},
+				// Block comments nest in WIT
 				"comment": {
+					{Pattern: `/\*`, Type: chroma.CommentMultiline, Mutator: chroma.Push("comment")},
 					{Pattern: `\*/`, Type: chroma.CommentMultiline, Mutator: chroma.Pop(1)},
-					{Pattern: `[^*]+`, Type: chroma.CommentMultiline, Mutator: nil},
-					{Pattern: `\*`, Type: chroma.CommentMultiline, Mutator: nil},
+					{Pattern: `[^*/]+`, Type: chroma.CommentMultiline, Mutator: nil},
+					{Pattern: `[*/]`, Type: chroma.CommentMultiline, Mutator: nil},
 				},
 			}
 		},
@@ -0,0 +1,7 @@
+package nebel
+
+import "testing"
+
+func TestWITLexer(t *testing.T) {
+	testLexerGolden(t, "wit", "testdata/wit/*.wit")
+}
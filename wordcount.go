@@ -0,0 +1,78 @@
+package nebel
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Reading speeds in words a minute. A CJK character counts as a word, and
+// Japanese is read at about 500 characters a minute.
+const (
+	latinWordsPerMinute = 200
+	cjkCharsPerMinute   = 500
+)
+
+// proseCount is what a post's Markdown says, leaving out fenced code.
+type proseCount struct {
+	// Chars are characters other than whitespace and Markdown punctuation.
+	Chars      int
+	LatinWords int
+	CJKChars   int
+}
+
+// Words counts each CJK character as a word.
+func (c proseCount) Words() int {
+	return c.LatinWords + c.CJKChars
+}
+
+// ReadingMinutes rounds up, so any text takes at least a minute.
+func (c proseCount) ReadingMinutes() int {
+	minutes := float64(c.LatinWords)/latinWordsPerMinute + float64(c.CJKChars)/cjkCharsPerMinute
+	return int(math.Ceil(minutes))
+}
+
+func countProse(markdown string) proseCount {
+	var c proseCount
+	fence := ""
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		inWord := false
+		for _, r := range line {
+			switch {
+			case isCJK(r) && (unicode.IsLetter(r) || isKanji(r)):
+				c.Chars++
+				c.CJKChars++
+				inWord = false
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				c.Chars++
+				if !inWord {
+					c.LatinWords++
+				}
+				inWord = true
+			case r == '\'' || r == '’':
+				// Keep "don't" one word
+				if inWord {
+					c.Chars++
+				}
+			default:
+				if !unicode.IsSpace(r) && !strings.ContainsRune("#*_`>[]()|~-", r) {
+					c.Chars++
+				}
+				inWord = false
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,51 @@
+package nebel
+
+import "testing"
+
+func TestCountProse(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     proseCount
+	}{
+		{"empty", "", proseCount{}},
+		{"latin", "Hello, world!", proseCount{Chars: 12, LatinWords: 2}},
+		{"apostrophe", "Don't panic", proseCount{Chars: 10, LatinWords: 2}},
+		{"markdown punctuation", "## A *b* [c](d)", proseCount{Chars: 4, LatinWords: 4}},
+		{"cjk", "日本語です。", proseCount{Chars: 6, CJKChars: 5}},
+		{"mixed", "Goの型", proseCount{Chars: 4, LatinWords: 1, CJKChars: 2}},
+		{"numbers", "Go 1.24", proseCount{Chars: 6, LatinWords: 3}},
+		{"fenced code", "before\n```go\nfunc main() {}\n```\nafter", proseCount{Chars: 11, LatinWords: 2}},
+		{"tilde fence", "~~~\ncode\n~~~\ntext", proseCount{Chars: 4, LatinWords: 1}},
+		{"unclosed fence", "text\n```\ncode", proseCount{Chars: 4, LatinWords: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countProse(tt.markdown); got != tt.want {
+				t.Errorf("countProse(%q) = %+v, want %+v", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadingMinutes(t *testing.T) {
+	tests := []struct {
+		count proseCount
+		want  int
+	}{
+		{proseCount{}, 0},
+		{proseCount{LatinWords: 1}, 1},
+		{proseCount{LatinWords: 200}, 1},
+		{proseCount{LatinWords: 201}, 2},
+		{proseCount{LatinWords: 1, CJKChars: 498}, 2}, // 1.001 minutes
+		{proseCount{CJKChars: 1000}, 2},
+		{proseCount{LatinWords: 100, CJKChars: 250}, 1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.count.ReadingMinutes(); got != tt.want {
+			t.Errorf("%+v.ReadingMinutes() = %d, want %d", tt.count, got, tt.want)
+		}
+	}
+}